@@ -0,0 +1,134 @@
+package main
+
+import (
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// reportFileType -- Returns the report file type the report reads, csv or xlsx
+func reportFileType(report reportStruct) string {
+	if report.UseXLSX {
+		return "xlsx"
+	}
+	return "csv"
+}
+
+// reportFileWanted -- Returns true if the report run output file should be retrieved for the report.
+// -- Compressed .gz files are retrieved when they contain the report file type, and .zip files are
+// -- always retrieved, as the file types they contain are only known once they are extracted.
+// -- When the report has Files patterns, the file name must also match one of them
+func reportFileWanted(report reportStruct, file reportFileStruct) bool {
+	fileType := reportFileType(report)
+	fileName := strings.ToLower(file.Name)
+	if strings.HasSuffix(fileName, ".zip") || file.Type == "zip" {
+		return true
+	}
+	if file.Type != fileType && !strings.HasSuffix(fileName, "."+fileType+".gz") {
+		return false
+	}
+	_, matched := reportFileTable(report, strings.TrimSuffix(fileName, ".gz"))
+	return matched
+}
+
+// extractReportFile -- Decompresses a downloaded .gz or .zip report file in to the extract folder, returning
+// -- the paths of the report files to process. Other files are returned as they are
+func extractReportFile(localPath, extractFolder string, report reportStruct) ([]string, bool) {
+	lowerPath := strings.ToLower(localPath)
+	switch {
+	case strings.HasSuffix(lowerPath, ".gz"):
+		extractedPath := filepath.Join(extractFolder, strings.TrimSuffix(filepath.Base(localPath), filepath.Ext(localPath)))
+		if err := extractGzipFile(localPath, extractedPath); err != nil {
+			logger(4, "Error decompressing "+filepath.Base(localPath)+": "+fmt.Sprintf("%v", err), true)
+			return nil, false
+		}
+		logger(3, "Decompressed "+filepath.Base(localPath)+" to "+extractedPath, false)
+		return []string{extractedPath}, true
+	case strings.HasSuffix(lowerPath, ".zip"):
+		extractedPaths, err := extractZipFile(localPath, extractFolder, reportFileType(report))
+		if err != nil {
+			logger(4, "Error extracting "+filepath.Base(localPath)+": "+fmt.Sprintf("%v", err), true)
+			return nil, false
+		}
+		if len(extractedPaths) == 0 {
+			logger(5, "No "+strings.ToUpper(reportFileType(report))+" files found in "+filepath.Base(localPath), true)
+		}
+		return extractedPaths, true
+	}
+	return []string{localPath}, true
+}
+
+func extractGzipFile(gzipPath, extractedPath string) error {
+	in, err := os.Open(gzipPath)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	gzipReader, err := gzip.NewReader(in)
+	if err != nil {
+		return err
+	}
+	defer gzipReader.Close()
+
+	out, err := os.Create(extractedPath)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	_, err = io.Copy(out, gzipReader)
+	return err
+}
+
+// extractZipFile -- Extracts the files of the given type from the zip archive in to the extract folder.
+// -- Entries in sub folders are extracted by their file name, with a _2, _3... suffix added when an earlier entry
+// -- of the archive has the same name
+func extractZipFile(zipPath, extractFolder, fileType string) ([]string, error) {
+	zipReader, err := zip.OpenReader(zipPath)
+	if err != nil {
+		return nil, err
+	}
+	defer zipReader.Close()
+
+	extractedPaths := []string{}
+	extractedNames := make(map[string]bool)
+	for _, zipFile := range zipReader.File {
+		//-- Only the base name is used, so entries can't be written outside the extract folder
+		fileName := filepath.Base(zipFile.Name)
+		if zipFile.FileInfo().IsDir() || !strings.EqualFold(filepath.Ext(fileName), "."+fileType) {
+			continue
+		}
+		extension := filepath.Ext(fileName)
+		baseName := strings.TrimSuffix(fileName, extension)
+		for suffix := 2; extractedNames[strings.ToLower(fileName)]; suffix++ {
+			fileName = baseName + "_" + strconv.Itoa(suffix) + extension
+		}
+		extractedNames[strings.ToLower(fileName)] = true
+		extractedPath := filepath.Join(extractFolder, fileName)
+		if err := extractZipEntry(zipFile, extractedPath); err != nil {
+			return extractedPaths, err
+		}
+		logger(3, "Extracted "+zipFile.Name+" from "+filepath.Base(zipPath)+" to "+fileName, false)
+		extractedPaths = append(extractedPaths, extractedPath)
+	}
+	return extractedPaths, nil
+}
+
+func extractZipEntry(zipFile *zip.File, extractedPath string) error {
+	in, err := zipFile.Open()
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(extractedPath)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	_, err = io.Copy(out, in)
+	return err
+}
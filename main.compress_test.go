@@ -0,0 +1,143 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestReportFileWanted(t *testing.T) {
+	csvReport := reportStruct{}
+	xlsxReport := reportStruct{UseXLSX: true}
+	filesReport := reportStruct{Files: []reportFileMapStruct{{Pattern: "incidents*.csv"}}}
+	tests := []struct {
+		name   string
+		report reportStruct
+		file   reportFileStruct
+		want   bool
+	}{
+		{"csv", csvReport, reportFileStruct{Name: "report.csv", Type: "csv"}, true},
+		{"xlsx for csv report", csvReport, reportFileStruct{Name: "report.xlsx", Type: "xlsx"}, false},
+		{"gzip csv", csvReport, reportFileStruct{Name: "report.csv.gz", Type: "gz"}, true},
+		{"gzip csv upper case", csvReport, reportFileStruct{Name: "REPORT.CSV.GZ", Type: "gz"}, true},
+		{"gzip xlsx for csv report", csvReport, reportFileStruct{Name: "report.xlsx.gz", Type: "gz"}, false},
+		{"gzip xlsx", xlsxReport, reportFileStruct{Name: "report.xlsx.gz", Type: "gz"}, true},
+		{"zip", csvReport, reportFileStruct{Name: "report.zip", Type: "zip"}, true},
+		{"zip by type", csvReport, reportFileStruct{Name: "report", Type: "zip"}, true},
+		{"pdf", csvReport, reportFileStruct{Name: "report.pdf", Type: "pdf"}, false},
+		{"files pattern match", filesReport, reportFileStruct{Name: "Incidents_1.csv", Type: "csv"}, true},
+		{"files pattern no match", filesReport, reportFileStruct{Name: "changes.csv", Type: "csv"}, false},
+		{"files pattern gzip match", filesReport, reportFileStruct{Name: "incidents_1.csv.gz", Type: "gz"}, true},
+		{"files pattern gzip no match", filesReport, reportFileStruct{Name: "changes.csv.gz", Type: "gz"}, false},
+		{"files pattern zip", filesReport, reportFileStruct{Name: "changes.zip", Type: "zip"}, true},
+	}
+	for _, tt := range tests {
+		if got := reportFileWanted(tt.report, tt.file); got != tt.want {
+			t.Errorf("%s: reportFileWanted(%q) = %v, want %v", tt.name, tt.file.Name, got, tt.want)
+		}
+	}
+}
+
+func TestExtractReportFileGzip(t *testing.T) {
+	dir := t.TempDir()
+	gzipPath := filepath.Join(dir, "report.csv.gz")
+	var content bytes.Buffer
+	gzipWriter := gzip.NewWriter(&content)
+	gzipWriter.Write([]byte("id\n1\n"))
+	gzipWriter.Close()
+	if err := os.WriteFile(gzipPath, content.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	reportFiles, ok := extractReportFile(gzipPath, dir, reportStruct{})
+	if !ok {
+		t.Fatal("extractReportFile failed")
+	}
+	wantFile := filepath.Join(dir, "report.csv")
+	if !reflect.DeepEqual(reportFiles, []string{wantFile}) {
+		t.Fatalf("extractReportFile = %q, want %q", reportFiles, []string{wantFile})
+	}
+	if got, _ := os.ReadFile(wantFile); string(got) != "id\n1\n" {
+		t.Errorf("extracted content = %q, want %q", got, "id\n1\n")
+	}
+}
+
+func TestExtractReportFileZip(t *testing.T) {
+	dir := t.TempDir()
+	zipPath := filepath.Join(dir, "report.zip")
+	var content bytes.Buffer
+	zipWriter := zip.NewWriter(&content)
+	entries := []struct {
+		name    string
+		content string
+	}{
+		{"exports/", ""},
+		{"exports/incidents.csv", "incidents"},
+		{"readme.txt", "readme"},
+		{"team a/changes.csv", "team a"},
+		{"team b/changes.csv", "team b"},
+		{"team c/CHANGES.CSV", "team c"},
+		{"../escape.csv", "escape"},
+	}
+	for _, entry := range entries {
+		writer, err := zipWriter.Create(entry.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		writer.Write([]byte(entry.content))
+	}
+	zipWriter.Close()
+	if err := os.WriteFile(zipPath, content.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	reportFiles, ok := extractReportFile(zipPath, dir, reportStruct{})
+	if !ok {
+		t.Fatal("extractReportFile failed")
+	}
+	wantContent := []struct {
+		name    string
+		content string
+	}{
+		{"incidents.csv", "incidents"},
+		{"changes.csv", "team a"},
+		{"changes_2.csv", "team b"},
+		{"CHANGES_3.CSV", "team c"},
+		{"escape.csv", "escape"},
+	}
+	wantFiles := []string{}
+	for _, want := range wantContent {
+		wantFiles = append(wantFiles, filepath.Join(dir, want.name))
+	}
+	if !reflect.DeepEqual(reportFiles, wantFiles) {
+		t.Fatalf("extractReportFile = %q, want %q", reportFiles, wantFiles)
+	}
+	for _, want := range wantContent {
+		if got, _ := os.ReadFile(filepath.Join(dir, want.name)); string(got) != want.content {
+			t.Errorf("%s content = %q, want %q", want.name, got, want.content)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "readme.txt")); err == nil {
+		t.Error("readme.txt extracted from the zip archive")
+	}
+}
+
+func TestProcessLocalFileExtractFailure(t *testing.T) {
+	for _, deleteLocal := range []bool{false, true} {
+		gzipPath := filepath.Join(t.TempDir(), "report.csv.gz")
+		if err := os.WriteFile(gzipPath, []byte("not gzip"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		destinations := []destinationStruct{{Type: "jsonl", Path: filepath.Join(t.TempDir(), "report.jsonl")}}
+		if processLocalFile(gzipPath, filepath.Dir(gzipPath), 1, reportStruct{}, destinations, deleteLocal, nil) {
+			t.Errorf("deleteLocal %v: processLocalFile succeeded with a corrupt gzip file", deleteLocal)
+		}
+		if _, err := os.Stat(gzipPath); (err == nil) == deleteLocal {
+			t.Errorf("deleteLocal %v: downloaded file exists = %v", deleteLocal, err == nil)
+		}
+	}
+}
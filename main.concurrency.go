@@ -0,0 +1,83 @@
+package main
+
+import (
+	"sync"
+
+	apiLib "github.com/hornbill/goApiLib"
+	hornbillHelpers "github.com/hornbill/goHornbillHelpers"
+)
+
+var (
+	// logLock - Serialises log writes, as the helper Logger redirects the standard logger on each call
+	logLock sync.Mutex
+	// stdoutLock - Serialises record writes to stdout, so the records of concurrent reports don't interleave
+	stdoutLock sync.Mutex
+)
+
+// logger -- Writes to the log file, and to the console when outputToCLI is set, from any report worker
+func logger(t int, s string, outputToCLI bool) {
+	logLock.Lock()
+	defer logLock.Unlock()
+	hornbillHelpers.Logger(t, s, outputToCLI, logFile)
+}
+
+// reportConcurrency -- Returns the number of reports to run at once, from the concurrency flag or the
+// -- Concurrency configuration setting, limited to the number of reports. Defaults to 1
+func reportConcurrency() int {
+	concurrency := configConcurrency
+	if concurrency < 1 {
+		concurrency = apiCallConfig.Concurrency
+	}
+	if concurrency > len(apiCallConfig.Reports) {
+		concurrency = len(apiCallConfig.Reports)
+	}
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	return concurrency
+}
+
+// newXmlmcSession -- Returns a new API session for the instance. Sessions hold the parameters of the
+// -- call being built, so each report worker needs its own
+func newXmlmcSession() *apiLib.XmlmcInstStruct {
+	espXmlmc := apiLib.NewXmlmcInstance(apiCallConfig.InstanceID)
+	espXmlmc.SetAPIKey(apiCallConfig.APIKey)
+	return espXmlmc
+}
+
+// runReports -- Runs (or imports) the configured reports, across concurrency workers that each
+// -- have their own API session. Returns the number of reports that failed
+func runReports(concurrency int) int {
+	var (
+		wg            sync.WaitGroup
+		failedLock    sync.Mutex
+		failedReports int
+	)
+	reports := make(chan reportStruct)
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			espXmlmc := newXmlmcSession()
+			for report := range reports {
+				success := false
+				if configImport != "" {
+					success = importReportFiles(configImport, report)
+				} else {
+					success = runReport(report, espXmlmc)
+				}
+				if !success {
+					failedLock.Lock()
+					failedReports++
+					failedLock.Unlock()
+				}
+			}
+		}()
+	}
+	for _, report := range apiCallConfig.Reports {
+		reports <- report
+	}
+	close(reports)
+	wg.Wait()
+	return failedReports
+}
@@ -1,88 +1,267 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
 	"encoding/csv"
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
+	"path"
+	"strconv"
+	"strings"
+	"unicode/utf8"
 
-	"github.com/xuri/excelize/v2"
-
-	hornbillHelpers "github.com/hornbill/goHornbillHelpers"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
 )
 
-func getRecordsFromCSV(csvFile string) (bool, []map[string]string) {
-	rows := []map[string]string{}
+// recordReader - Reads the records from a local report file one at a time, so that
+// -- large reports can be delivered without holding the whole file in memory
+type recordReader interface {
+	Header() []string
+	Total() int
+	Read() (map[string]string, error)
+	Malformed() int
+	Close() error
+}
+
+// openRecordReader -- Opens the CSV or XLSX report file for reading, depending on the report UseXLSX setting
+func openRecordReader(reportFile string, output outputContext) (recordReader, bool) {
+	if output.Report.UseXLSX {
+		return newXLSXRecordReader(reportFile, output.Sheet)
+	}
+	return newCSVRecordReader(reportFile, output.Report.CSV)
+}
+
+// reportSources -- Returns the output context for each set of records to read from the report file.
+// -- CSV files have a single set of records, XLSX files have one per selected sheet
+func reportSources(reportFile string, output outputContext) ([]outputContext, bool) {
+	if !output.Report.UseXLSX {
+		return []outputContext{output}, true
+	}
+	sheets, success := xlsxSheets(reportFile, output.Report)
+	if !success {
+		return nil, false
+	}
+	sources := []outputContext{}
+	for _, sheet := range sheets {
+		source := output
+		source.Sheet = sheet
+		if table, ok := output.Report.SheetTables[sheet]; ok {
+			source.Report.Table = table
+		}
+		if len(sheets) > 1 {
+			//-- Keep the file name unique for each sheet, so destination paths don't collide
+			extension := path.Ext(output.FileName)
+			source.FileName = strings.TrimSuffix(output.FileName, extension) + "_" + sheet + extension
+		}
+		sources = append(sources, source)
+	}
+	return sources, true
+}
+
+// csvRecordReader - Streams records from a CSV report file
+type csvRecordReader struct {
+	file      *os.File
+	config    csvConfigStruct
+	encoding  encoding.Encoding
+	reader    *csv.Reader
+	header    []string
+	total     int
+	read      int
+	malformed int
+}
+
+// newCSVRecordReader -- Opens the CSV file and counts its records, then positions the reader at the first record
+func newCSVRecordReader(csvFile string, csvConfig csvConfigStruct) (recordReader, bool) {
+	r := &csvRecordReader{config: csvConfig}
+	if csvConfigRune(csvConfig.Delimiter) == 0 || (csvConfig.Comment != "" && csvConfigRune(csvConfig.Comment) == 0) {
+		logger(4, "Invalid CSV Delimiter or Comment character", true)
+		return nil, false
+	}
+	if csvConfig.Encoding != "" {
+		var err error
+		r.encoding, err = htmlindex.Get(csvConfig.Encoding)
+		if err != nil {
+			logger(4, "Unsupported CSV Encoding "+csvConfig.Encoding+": "+fmt.Sprintf("%v", err), true)
+			return nil, false
+		}
+	}
 	file, err := os.Open(csvFile)
 	if err != nil {
-		hornbillHelpers.Logger(4, "Error opening CSV file: "+fmt.Sprintf("%v", err), true, logFile)
-		return false, rows
+		logger(4, "Error opening CSV file: "+fmt.Sprintf("%v", err), true)
+		return nil, false
 	}
-	defer file.Close()
+	r.file = file
 
-	bom := make([]byte, 3)
-	file.Read(bom)
-	if bom[0] == 0xEF && bom[1] == 0xBB && bom[2] == 0xBF {
-		// BOM Detected, continue with feeding the file
-	} else {
-		// No BOM Detected, reset the file feed
-		file.Seek(0, 0)
+	//-- Count the records first, so the progress and failure thresholds can be measured against the total
+	err = r.rewind()
+	if err == nil {
+		r.reader.ReuseRecord = true
+		for {
+			_, err = r.reader.Read()
+			if err != nil {
+				break
+			}
+			r.total++
+		}
+	}
+	if err == io.EOF {
+		err = r.rewind()
+	}
+	if err != nil {
+		logger(4, "Error reading CSV data: "+fmt.Sprintf("%v", err), true)
+		file.Close()
+		return nil, false
+	}
+	//-- First record read is the header, and any trailing summary records are not read
+	r.total -= 1 + csvConfig.SkipTrailingLines
+	if r.total < 0 {
+		r.total = 0
+	}
+
+	header, err := r.reader.Read()
+	if err != nil && err != io.EOF {
+		logger(4, "Error reading CSV data: "+fmt.Sprintf("%v", err), true)
+		file.Close()
+		return nil, false
 	}
+	r.header = uniqueHeader(header)
+	return r, true
+}
 
-	r := csv.NewReader(file)
-	r.LazyQuotes = true
+// rewind - positions the reader at the start of the file, skipping any byte order mark and the
+// -- CSV SkipLines of the report. Files with a UTF-16 byte order mark are decoded as UTF-16, otherwise
+// -- files are decoded from the CSV Encoding of the report when set, or read as UTF-8
+func (r *csvRecordReader) rewind() error {
+	r.file.Seek(0, io.SeekStart)
+	bom := make([]byte, 3)
+	bomLength, _ := io.ReadFull(r.file, bom)
+	bom = bom[:bomLength]
 
-	var header []string
+	fileEncoding := r.encoding
+	dataStart := int64(0)
+	switch {
+	case bytes.HasPrefix(bom, []byte{0xEF, 0xBB, 0xBF}):
+		// UTF-8 BOM Detected, continue with feeding the file
+		dataStart = 3
+		fileEncoding = nil
+	case bytes.HasPrefix(bom, []byte{0xFF, 0xFE}):
+		dataStart = 2
+		fileEncoding = unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM)
+	case bytes.HasPrefix(bom, []byte{0xFE, 0xFF}):
+		dataStart = 2
+		fileEncoding = unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM)
+	}
+	r.file.Seek(dataStart, io.SeekStart)
 
-	for {
-		record, err := r.Read()
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			hornbillHelpers.Logger(4, "Error reading CSV data: "+fmt.Sprintf("%v", err), true, logFile)
-			return false, rows
-		}
-		if header == nil {
-			header = record
-		} else {
-			dict := map[string]string{}
-			for i := range header {
-				dict[header[i]] = record[i]
+	var fileReader io.Reader = r.file
+	if fileEncoding != nil {
+		fileReader = transform.NewReader(r.file, fileEncoding.NewDecoder())
+	}
+	bufferedReader := bufio.NewReader(fileReader)
+	for i := 0; i < r.config.SkipLines; i++ {
+		if _, err := bufferedReader.ReadString('\n'); err != nil {
+			//-- Files shorter than SkipLines are read as having no records
+			if err == io.EOF {
+				break
 			}
-			rows = append(rows, dict)
+			return err
 		}
 	}
-	return true, rows
 
+	r.reader = csv.NewReader(bufferedReader)
+	r.reader.Comma = csvConfigRune(r.config.Delimiter)
+	r.reader.LazyQuotes = !r.config.StrictQuotes
+	if r.config.Comment != "" {
+		r.reader.Comment = csvConfigRune(r.config.Comment)
+	}
+	//-- Allow records with a different number of fields to the header, they are handled by buildRecord
+	r.reader.FieldsPerRecord = -1
+	r.read = 0
+	return nil
 }
 
-func getRecordsFromXLSX(xlsxFile string) (bool, []map[string]string) {
-	rows := []map[string]string{}
-	f, err := excelize.OpenFile(xlsxFile)
-	if err != nil {
-		hornbillHelpers.Logger(4, "Error opening XLSX file: "+err.Error(), true, logFile)
-		return false, rows
+// csvConfigRune -- Returns the character set for a CSV Delimiter or Comment setting.
+// -- Delimiters default to a comma, and tab can be given by name. Returns 0 if the setting is invalid
+func csvConfigRune(setting string) rune {
+	switch strings.ToLower(setting) {
+	case "":
+		return ','
+	case "tab":
+		return '\t'
+	}
+	character, size := utf8.DecodeRuneInString(setting)
+	if size != len(setting) || character == utf8.RuneError || character == '"' || character == '\r' || character == '\n' {
+		return 0
 	}
+	return character
+}
+
+// Header - returns the column names from the first line of the file
+func (r *csvRecordReader) Header() []string {
+	return r.header
+}
 
-	// Get all the rows in the Sheet1.
-	rowsArr, err := f.GetRows("Sheet1")
+// Total - returns the number of records in the file, excluding the header
+func (r *csvRecordReader) Total() int {
+	return r.total
+}
+
+// Read - returns the next record keyed on the header column names, or io.EOF once all records
+// -- before any trailing summary records are read
+func (r *csvRecordReader) Read() (map[string]string, error) {
+	if r.read >= r.total {
+		return nil, io.EOF
+	}
+	record, err := r.reader.Read()
 	if err != nil {
-		hornbillHelpers.Logger(4, "Error reading XLSX file: "+err.Error(), true, logFile)
-		return false, rows
+		return nil, err
+	}
+	r.read++
+	line, _ := r.reader.FieldPos(0)
+	dict, malformed := buildRecord(r.header, record, "line "+strconv.Itoa(line+r.config.SkipLines), true)
+	if malformed {
+		r.malformed++
 	}
-	var header []string
-	for _, row := range rowsArr {
-		if header == nil {
-			header = row
+	return dict, nil
+}
+
+// Malformed - returns the number of records read that did not match the header
+func (r *csvRecordReader) Malformed() int {
+	return r.malformed
+}
+
+// Close - closes the CSV file
+func (r *csvRecordReader) Close() error {
+	return r.file.Close()
+}
+
+// buildRecord -- Returns the record fields keyed on the header column names.
+// -- Records with fewer fields than the header are padded with empty values, and records with
+// -- more fields have the extra fields dropped. Returns true if the record was malformed, which
+// -- for short records is only when shortMalformed is set, as XLSX rows omit trailing empty cells
+func buildRecord(header, record []string, location string, shortMalformed bool) (map[string]string, bool) {
+	dict := make(map[string]string, len(header))
+	for i := range header {
+		if i < len(record) {
+			dict[header[i]] = record[i]
 		} else {
-			dict := map[string]string{}
-			for i := range header {
-				dict[header[i]] = row[i]
-			}
-			rows = append(rows, dict)
+			dict[header[i]] = ""
 		}
 	}
-
-	return true, rows
+	if len(record) > len(header) {
+		jsonExtra, _ := json.Marshal(record[len(header):])
+		logger(4, "Malformed record at "+location+": "+strconv.Itoa(len(record))+" fields found for "+strconv.Itoa(len(header))+" columns, extra fields dropped: "+string(jsonExtra), false)
+		return dict, true
+	}
+	if len(record) < len(header) && shortMalformed {
+		logger(4, "Malformed record at "+location+": "+strconv.Itoa(len(record))+" fields found for "+strconv.Itoa(len(header))+" columns, missing fields left empty", false)
+		return dict, true
+	}
+	return dict, false
 }
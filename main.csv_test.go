@@ -0,0 +1,204 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"unicode/utf16"
+)
+
+func TestCSVConfigRune(t *testing.T) {
+	tests := []struct {
+		setting string
+		want    rune
+	}{
+		{"", ','},
+		{";", ';'},
+		{"|", '|'},
+		{"tab", '\t'},
+		{"TAB", '\t'},
+		{"\t", '\t'},
+		{"§", '§'},
+		{"#", '#'},
+		{"ab", 0},
+		{"\"", 0},
+		{"\n", 0},
+		{"\r", 0},
+		{"\xff", 0},
+	}
+	for _, tt := range tests {
+		if got := csvConfigRune(tt.setting); got != tt.want {
+			t.Errorf("csvConfigRune(%q) = %q, want %q", tt.setting, got, tt.want)
+		}
+	}
+}
+
+func TestCSVRecordReaderSkipLines(t *testing.T) {
+	tests := []struct {
+		name       string
+		content    string
+		config     csvConfigStruct
+		wantHeader []string
+		wantTotal  int
+	}{
+		{"no skip", "id,name\n1,a\n2,b\n", csvConfigStruct{}, []string{"id", "name"}, 2},
+		{"title lines", "Report\nRun today\nid,name\n1,a\n", csvConfigStruct{SkipLines: 2}, []string{"id", "name"}, 1},
+		{"trailing summary", "id,name\n1,a\n2,b\nTotal,2\n", csvConfigStruct{SkipTrailingLines: 1}, []string{"id", "name"}, 2},
+		{"shorter than skip lines", "Report\n", csvConfigStruct{SkipLines: 3}, []string{}, 0},
+		{"empty file", "", csvConfigStruct{SkipLines: 1}, []string{}, 0},
+		{"semicolon delimiter", "id;name\n1;a\n", csvConfigStruct{Delimiter: ";"}, []string{"id", "name"}, 1},
+	}
+	dir := t.TempDir()
+	for _, tt := range tests {
+		csvFile := filepath.Join(dir, "report.csv")
+		if err := os.WriteFile(csvFile, []byte(tt.content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		reader, ok := newCSVRecordReader(csvFile, tt.config)
+		if !ok {
+			t.Errorf("%s: newCSVRecordReader failed", tt.name)
+			continue
+		}
+		if got := reader.Header(); !reflect.DeepEqual(got, tt.wantHeader) {
+			t.Errorf("%s: Header = %q, want %q", tt.name, got, tt.wantHeader)
+		}
+		if got := reader.Total(); got != tt.wantTotal {
+			t.Errorf("%s: Total = %d, want %d", tt.name, got, tt.wantTotal)
+		}
+		reader.Close()
+	}
+}
+
+// readCSVTestFile -- Writes the content to a CSV file and returns the header, records and malformed count read from it
+func readCSVTestFile(t *testing.T, content []byte, config csvConfigStruct) ([]string, []map[string]string, int) {
+	t.Helper()
+	csvFile := filepath.Join(t.TempDir(), "report.csv")
+	if err := os.WriteFile(csvFile, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	reader, ok := newCSVRecordReader(csvFile, config)
+	if !ok {
+		t.Fatal("newCSVRecordReader failed")
+	}
+	defer reader.Close()
+	records := []map[string]string{}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Read: %v", err)
+		}
+		records = append(records, record)
+	}
+	return reader.Header(), records, reader.Malformed()
+}
+
+func TestBuildRecord(t *testing.T) {
+	header := []string{"id", "name", "team"}
+	tests := []struct {
+		name           string
+		record         []string
+		shortMalformed bool
+		want           map[string]string
+		wantMalformed  bool
+	}{
+		{"matching", []string{"1", "a", "x"}, true, map[string]string{"id": "1", "name": "a", "team": "x"}, false},
+		{"short csv row", []string{"1"}, true, map[string]string{"id": "1", "name": "", "team": ""}, true},
+		{"short xlsx row", []string{"1", "a"}, false, map[string]string{"id": "1", "name": "a", "team": ""}, false},
+		{"empty row", []string{}, true, map[string]string{"id": "", "name": "", "team": ""}, true},
+		{"long row", []string{"1", "a", "x", "extra", "more"}, true, map[string]string{"id": "1", "name": "a", "team": "x"}, true},
+		{"long xlsx row", []string{"1", "a", "x", "extra"}, false, map[string]string{"id": "1", "name": "a", "team": "x"}, true},
+	}
+	for _, tt := range tests {
+		got, malformed := buildRecord(header, tt.record, "line 2", tt.shortMalformed)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: record = %q, want %q", tt.name, got, tt.want)
+		}
+		if malformed != tt.wantMalformed {
+			t.Errorf("%s: malformed = %v, want %v", tt.name, malformed, tt.wantMalformed)
+		}
+	}
+}
+
+func TestCSVRecordReaderMalformedRows(t *testing.T) {
+	content := "id,name,team\n1,a,x\n2\n3,c,z,extra\n4,d,w\n"
+	header, records, malformed := readCSVTestFile(t, []byte(content), csvConfigStruct{})
+	if want := []string{"id", "name", "team"}; !reflect.DeepEqual(header, want) {
+		t.Errorf("Header = %q, want %q", header, want)
+	}
+	wantRecords := []map[string]string{
+		{"id": "1", "name": "a", "team": "x"},
+		{"id": "2", "name": "", "team": ""},
+		{"id": "3", "name": "c", "team": "z"},
+		{"id": "4", "name": "d", "team": "w"},
+	}
+	if !reflect.DeepEqual(records, wantRecords) {
+		t.Errorf("records = %q, want %q", records, wantRecords)
+	}
+	if malformed != 2 {
+		t.Errorf("Malformed = %d, want 2", malformed)
+	}
+}
+
+// utf16TestContent -- Returns the text encoded as UTF-16 with a byte order mark
+func utf16TestContent(text string, bigEndian bool) []byte {
+	content := []byte{0xFF, 0xFE}
+	if bigEndian {
+		content = []byte{0xFE, 0xFF}
+	}
+	for _, unit := range utf16.Encode([]rune(text)) {
+		if bigEndian {
+			content = append(content, byte(unit>>8), byte(unit))
+		} else {
+			content = append(content, byte(unit), byte(unit>>8))
+		}
+	}
+	return content
+}
+
+func TestCSVRecordReaderEncoding(t *testing.T) {
+	utf16Text := "id,name\r\n1,Café ☕\r\n"
+	tests := []struct {
+		name     string
+		content  []byte
+		config   csvConfigStruct
+		wantName string
+	}{
+		{"utf-8", []byte("id,name\n1,Café ☕\n"), csvConfigStruct{}, "Café ☕"},
+		{"utf-8 bom", []byte("\xEF\xBB\xBFid,name\n1,Café ☕\n"), csvConfigStruct{}, "Café ☕"},
+		{"utf-16le bom", utf16TestContent(utf16Text, false), csvConfigStruct{}, "Café ☕"},
+		{"utf-16be bom", utf16TestContent(utf16Text, true), csvConfigStruct{}, "Café ☕"},
+		{"utf-16 bom overrides encoding", utf16TestContent(utf16Text, false), csvConfigStruct{Encoding: "windows-1252"}, "Café ☕"},
+		{"utf-16 bom with skip lines", utf16TestContent("Incidents\r\n"+utf16Text, false), csvConfigStruct{SkipLines: 1}, "Café ☕"},
+		{"windows-1252", []byte("id,name\n1,Caf\xE9 \xE2\x98\x95\n"), csvConfigStruct{Encoding: "windows-1252"}, "Café â˜•"},
+		{"iso-8859-1", []byte("id,name\n1,Caf\xE9\n"), csvConfigStruct{Encoding: "ISO-8859-1"}, "Café"},
+	}
+	for _, tt := range tests {
+		header, records, _ := readCSVTestFile(t, tt.content, tt.config)
+		if want := []string{"id", "name"}; !reflect.DeepEqual(header, want) {
+			t.Errorf("%s: Header = %q, want %q", tt.name, header, want)
+		}
+		if len(records) != 1 {
+			t.Errorf("%s: %d records read, want 1", tt.name, len(records))
+			continue
+		}
+		if records[0]["name"] != tt.wantName {
+			t.Errorf("%s: name = %q, want %q", tt.name, records[0]["name"], tt.wantName)
+		}
+	}
+}
+
+func TestCSVRecordReaderUnsupportedEncoding(t *testing.T) {
+	csvFile := filepath.Join(t.TempDir(), "report.csv")
+	if err := os.WriteFile(csvFile, []byte("id\n1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if reader, ok := newCSVRecordReader(csvFile, csvConfigStruct{Encoding: "not-an-encoding"}); ok {
+		reader.Close()
+		t.Error("newCSVRecordReader succeeded with an unsupported Encoding")
+	}
+}
@@ -2,11 +2,10 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strconv"
 	"strings"
-
-	hornbillHelpers "github.com/hornbill/goHornbillHelpers"
 )
 
 // buildConnectionString -- Build the connection string for the SQL driver
@@ -15,10 +14,10 @@ func buildConnectionString() string {
 	if apiCallConfig.Database.Database == "" ||
 		apiCallConfig.Database.Authentication == "SQL" && (apiCallConfig.Database.UserName == "" || apiCallConfig.Database.Password == "") {
 		//Conf not set - log error and return empty string
-		hornbillHelpers.Logger(4, "Database configuration not set.", true, logFile)
+		logger(4, "Database configuration not set.", true)
 		return ""
 	}
-	hornbillHelpers.Logger(1, "Connecting to Database Server: "+apiCallConfig.Database.Server, true, logFile)
+	logger(1, "Connecting to Database Server: "+apiCallConfig.Database.Server, true)
 
 	switch apiCallConfig.Database.Driver {
 	case "mssql":
@@ -189,43 +188,84 @@ func upsertRecord(reportRecord map[string]string, report reportStruct, counters
 
 	if len(namedData) == 0 {
 		counters.failed++
-		hornbillHelpers.Logger(4, "Unable to map any values from the returned record:", false, logFile)
+		logger(4, "Unable to map any values from the returned record:", false)
 		jsonRecord, _ := json.Marshal(reportRecord)
-		hornbillHelpers.Logger(3, "[RECORD] "+string(jsonRecord), false, logFile)
+		logger(3, "[RECORD] "+string(jsonRecord), false)
 		jsonMapping, _ := json.Marshal(report.Table.Mapping)
-		hornbillHelpers.Logger(3, "[MAPPINGS] "+string(jsonMapping), false, logFile)
+		logger(3, "[MAPPINGS] "+string(jsonMapping), false)
 
 		return
 	}
 
 	if configDebug {
 		//Add query & params to log
-		hornbillHelpers.Logger(3, "[DATABASE] Query:"+sqlQuery, false, logFile)
-		hornbillHelpers.Logger(3, "[DATABASE] Binding:", false, logFile)
+		logger(3, "[DATABASE] Query:"+sqlQuery, false)
+		logger(3, "[DATABASE] Binding:", false)
 		for k, v := range namedData {
-			hornbillHelpers.Logger(3, "[DATABASE] :"+k+" = "+fmt.Sprintf("%v", v), false, logFile)
+			logger(3, "[DATABASE] :"+k+" = "+fmt.Sprintf("%v", v), false)
 		}
 	}
 
 	results, err := db.NamedExec(sqlQuery, namedData)
 	if err != nil {
-		hornbillHelpers.Logger(4, " [DATABASE] NamedExec Error: "+fmt.Sprintf("%v", err), true, logFile)
+		logger(4, " [DATABASE] NamedExec Error: "+fmt.Sprintf("%v", err), true)
 		counters.failed++
 		return
 	}
 	if configDebug {
-		hornbillHelpers.Logger(3, "[DATABASE] NamedExec Success", false, logFile)
+		logger(3, "[DATABASE] NamedExec Success", false)
 	}
 	counters.success++
 
 	affectedCount, err := results.RowsAffected()
 	if err != nil {
-		hornbillHelpers.Logger(4, " [DATABASE] RowsAffected Error: "+fmt.Sprintf("%v", err), false, logFile)
+		logger(4, " [DATABASE] RowsAffected Error: "+fmt.Sprintf("%v", err), false)
 		return
 	}
 	if configDebug {
-		hornbillHelpers.Logger(3, "[DATABASE] RowsAffected: "+strconv.FormatInt(affectedCount, 10), false, logFile)
+		logger(3, "[DATABASE] RowsAffected: "+strconv.FormatInt(affectedCount, 10), false)
 	}
 
 	counters.rowsaffected += int(affectedCount)
 }
+
+// databaseSink - Delivers report records to the configured SQL database table
+type databaseSink struct {
+	report reportStruct
+}
+
+func newDatabaseSink(destination destinationStruct) sink {
+	return &databaseSink{}
+}
+
+// Open - checks the global database connection is available for the report
+func (s *databaseSink) Open(output outputContext) error {
+	if db == nil {
+		return errors.New("database connection is not open")
+	}
+	s.report = output.Report
+	return nil
+}
+
+// WriteBatch - upserts each record in the batch in to the report table
+func (s *databaseSink) WriteBatch(rows []map[string]string, counters *counterStruct) error {
+	for _, reportRow := range rows {
+		upsertRecord(reportRow, s.report, counters)
+	}
+	return nil
+}
+
+// Commit - records are upserted as they are written, so there is nothing to commit
+func (s *databaseSink) Commit(counters *counterStruct) error {
+	return nil
+}
+
+// Pending - records are written to the database as they are received
+func (s *databaseSink) Pending() int {
+	return 0
+}
+
+// Close - the database connection is shared between reports, so is left open
+func (s *databaseSink) Close() error {
+	return nil
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"compress/gzip"
 	"encoding/json"
 	"encoding/xml"
 	"flag"
@@ -10,6 +11,8 @@ import (
 	"net/http"
 	"os"
 	"path"
+	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -17,9 +20,9 @@ import (
 	"github.com/dustin/go-humanize"
 	"github.com/hornbill/color"
 	apiLib "github.com/hornbill/goApiLib"
-	hornbillHelpers "github.com/hornbill/goHornbillHelpers"
 	"github.com/hornbill/pb"
 	"github.com/jmoiron/sqlx"
+	"github.com/mattn/go-colorable"
 
 	//SQL Drivers
 	_ "github.com/denisenkom/go-mssqldb" //Microsoft SQL Server driver - v2005+
@@ -32,7 +35,12 @@ func main() {
 	flag.IntVar(&configTimeout, "timeout", 30, "The number of seconds to allow the CSV retrieval to wait before timing out")
 	flag.BoolVar(&configDebug, "debug", false, "Debug mode - additional logging")
 	flag.BoolVar(&configVersion, "version", false, "Return version and end")
+	flag.IntVar(&configConcurrency, "concurrency", 0, "The number of reports to run at once, overriding the Concurrency configuration setting")
 	flag.BoolVar(&configSkipInsert, "skipdb", false, "Set to true to skip the insert/update of report records into the database")
+	flag.StringVar(&configImport, "import", "", "Path of a report file, or folder of report files, to import without running the report on the instance")
+	flag.Var(configParams, "param", "A report runtime parameter as name=value, overriding the report Parameters. Can be repeated")
+	flag.StringVar(&configStateFile, "statefile", "", "Path of the state file used to resume interrupted report runs, overriding the StateFile configuration setting")
+	flag.StringVar(&configReport, "report", "", "ID or name of the report definition to use with -import")
 	flag.Parse()
 
 	//-- If configVersion just output version number and die
@@ -41,132 +49,276 @@ func main() {
 		return
 	}
 
-	hornbillHelpers.Logger(3, "---- "+toolName+" v"+version+" ----", true, logFile)
-	hornbillHelpers.Logger(3, "Flag - Configuration File: "+configFileName, true, logFile)
-	hornbillHelpers.Logger(3, "Flag - Debug: "+fmt.Sprintf("%v", configDebug), true, logFile)
-
 	//-- Load Configuration File Into Struct
 	apiCallConfig, boolConfLoaded = loadConfig()
 	if !boolConfLoaded {
-		hornbillHelpers.Logger(4, "Unable to load config, process closing.", true, logFile)
-		return
+		logger(4, "Unable to load config, process closing.", true)
+		os.Exit(exitCodeTotalFailure)
+	}
+
+	//-- Load the state of any report runs interrupted by an earlier invocation
+	if configStateFile == "" {
+		configStateFile = apiCallConfig.StateFile
+	}
+	if !loadRunState() {
+		os.Exit(exitCodeTotalFailure)
+	}
+
+	//-- Only the report definition being imported is used in import mode
+	if configImport != "" {
+		importReport, found := importReportDefinition()
+		if !found {
+			os.Exit(exitCodeTotalFailure)
+		}
+		apiCallConfig.Reports = []reportStruct{importReport}
+	}
+
+	//-- Keep stdout for report records when a destination writes to it, and send console output to stderr
+	if stdoutRequired() {
+		stdoutFile = os.Stdout
+		os.Stdout = os.Stderr
+		color.Output = colorable.NewColorableStderr()
+	}
+
+	logger(3, "---- "+toolName+" v"+version+" ----", true)
+	logger(3, "Flag - Configuration File: "+configFileName, true)
+	logger(3, "Flag - Debug: "+fmt.Sprintf("%v", configDebug), true)
+	logger(3, "Instance ID: "+apiCallConfig.InstanceID, true)
+	if configImport != "" {
+		logger(3, "Flag - Import: "+configImport, true)
 	}
-	hornbillHelpers.Logger(3, "Instance ID: "+apiCallConfig.InstanceID, true, logFile)
 
-	//Global XMLMC session
-	espXmlmc = apiLib.NewXmlmcInstance(apiCallConfig.InstanceID)
-	espXmlmc.SetAPIKey(apiCallConfig.APIKey)
+	configConcurrency = reportConcurrency()
+	logger(3, "Concurrency: "+strconv.Itoa(configConcurrency), true)
+
 	davEndpoint = apiLib.GetEndPointFromName(apiCallConfig.InstanceID) + "/dav/"
 
-	if !configSkipInsert {
+	if !configSkipInsert && databaseRequired() {
 		connString = buildConnectionString()
 		if connString == "" {
-			hornbillHelpers.Logger(4, "Database Connection String Empty. Check the SQLConf section of your configuration.", true, logFile)
-			return
+			logger(4, "Database Connection String Empty. Check the SQLConf section of your configuration.", true)
+			os.Exit(exitCodeTotalFailure)
 		}
 
 		if configDebug {
-			hornbillHelpers.Logger(1, "Database Server: "+apiCallConfig.Database.Server, false, logFile)
-			hornbillHelpers.Logger(1, "Database Port: "+strconv.Itoa(apiCallConfig.Database.Port), false, logFile)
-			hornbillHelpers.Logger(1, "Database Driver: "+apiCallConfig.Database.Driver, false, logFile)
-			hornbillHelpers.Logger(1, "Database Encryption: "+fmt.Sprintf("%v", apiCallConfig.Database.Encrypt), false, logFile)
-			hornbillHelpers.Logger(1, "Database Server Authentication: "+apiCallConfig.Database.Authentication, false, logFile)
-			hornbillHelpers.Logger(1, "Database: "+apiCallConfig.Database.Database, false, logFile)
-			hornbillHelpers.Logger(1, "Database Connection String: "+connString, false, logFile)
-		}
-		
+			logger(1, "Database Server: "+apiCallConfig.Database.Server, false)
+			logger(1, "Database Port: "+strconv.Itoa(apiCallConfig.Database.Port), false)
+			logger(1, "Database Driver: "+apiCallConfig.Database.Driver, false)
+			logger(1, "Database Encryption: "+fmt.Sprintf("%v", apiCallConfig.Database.Encrypt), false)
+			logger(1, "Database Server Authentication: "+apiCallConfig.Database.Authentication, false)
+			logger(1, "Database: "+apiCallConfig.Database.Database, false)
+			logger(1, "Database Connection String: "+connString, false)
+		}
+
 		// Create global DB connection
 		var dberr error
 		db, dberr = sqlx.Open(apiCallConfig.Database.Driver, connString)
 		if dberr != nil {
-			hornbillHelpers.Logger(4, " [DATABASE] Connection Error: "+fmt.Sprintf("%v", dberr), true, logFile)
-			return
+			logger(4, " [DATABASE] Connection Error: "+fmt.Sprintf("%v", dberr), true)
+			os.Exit(exitCodeTotalFailure)
 		}
-		defer db.Close()
 		//Check connection is open
 		dberr = db.Ping()
 		if dberr != nil {
-			hornbillHelpers.Logger(4, " [DATABASE] Ping Error: "+fmt.Sprintf("%v", dberr), true, logFile)
-			return
+			logger(4, " [DATABASE] Ping Error: "+fmt.Sprintf("%v", dberr), true)
+			db.Close()
+			os.Exit(exitCodeTotalFailure)
 		}
 
 	}
 
 	//Run and get report content
-	for _, definition := range apiCallConfig.Reports {
-		runReport(definition, espXmlmc)
+	failedReports := runReports(configConcurrency)
+
+	if db != nil {
+		db.Close()
+	}
+	workbooksSaved := saveWorkbooks()
+
+	//-- Exit with a non-zero status so schedulers can alert on failed reports
+	if failedReports > 0 {
+		logger(3, " ", true)
+		logger(4, strconv.Itoa(failedReports)+" of "+strconv.Itoa(len(apiCallConfig.Reports))+" Reports Failed", true)
 	}
+	if exitCode := runExitCode(failedReports, len(apiCallConfig.Reports), workbooksSaved); exitCode != 0 {
+		os.Exit(exitCode)
+	}
+}
 
+// runExitCode -- Returns the process exit code for the reports run. Fails totally when every report failed,
+// -- and partially when some reports failed or the workbooks could not be saved
+func runExitCode(failedReports, totalReports int, workbooksSaved bool) int {
+	if failedReports > 0 && failedReports == totalReports {
+		return exitCodeTotalFailure
+	}
+	if failedReports > 0 || !workbooksSaved {
+		return exitCodePartialFailure
+	}
+	return 0
 }
 
-func runReport(report reportStruct, espXmlmc *apiLib.XmlmcInstStruct) {
-	hornbillHelpers.Logger(3, " ", true, logFile)
-	hornbillHelpers.Logger(7, "Running Report: "+report.ReportName+" ["+strconv.Itoa(report.ReportID)+"]", true, logFile)
+// runReport -- Runs the report on the instance, waits for completion and processes the output
+// -- Returns false if the report run or processing of its output failed
+func runReport(report reportStruct, espXmlmc *apiLib.XmlmcInstStruct) bool {
+	logger(3, " ", true)
+	logger(7, "Running Report: "+report.ReportName+" ["+strconv.Itoa(report.ReportID)+"]", true)
+
+	state := reportState(report)
+	runID := state.resumeRunID()
+	reusedRun := false
+	if runID > 0 && !state.resumeAttempt() {
+		logger(5, "Abandoning Report Run ID ["+strconv.Itoa(runID)+"] from the state file after "+strconv.Itoa(state.Attempts)+" attempts to resume it", true)
+		if report.DeleteReportInstance && !state.Reused {
+			deleteReportInstance(runID, espXmlmc)
+		}
+		state.clear()
+		runID = 0
+	}
+	if runID > 0 {
+		logger(3, "Resuming Report Run ID ["+strconv.Itoa(runID)+"] from the state file", true)
+		reusedRun = state.Reused
+	} else {
+		if report.ReuseLatestRun {
+			runID = latestReportRun(report, espXmlmc)
+		}
+		reusedRun = runID > 0
+		if !reusedRun {
+			var runStarted bool
+			runID, runStarted = startReportRun(report, espXmlmc)
+			if !runStarted {
+				return false
+			}
+		}
+		state.setRun(runID, reusedRun)
+	}
+	reportDetails, reportSuccess, runEnded := waitForReport(runID, report, espXmlmc)
+	if !reportSuccess {
+		//-- Runs that could not be checked or timed out may still be on the instance, so their state
+		//-- is kept for the next invocation to resume
+		if runEnded {
+			state.clear()
+		}
+		return false
+	}
+	state.setProcessing()
+	contentSuccess := getReportContent(reportDetails, espXmlmc, report, state)
+	if contentSuccess {
+		state.clear()
+	}
+	//-- Reused runs were not started by the tool, so are left on the instance. Runs that failed
+	//-- to process are also left when there is a state file, so the next invocation can resume them
+	if report.DeleteReportInstance && !reusedRun && (contentSuccess || state == nil) {
+		deleteReportInstance(reportDetails.ReportRun.RunID, espXmlmc)
+	}
+	return contentSuccess
+}
 
+// startReportRun -- Starts a new run of the report on the instance, returning its run ID
+func startReportRun(report reportStruct, espXmlmc *apiLib.XmlmcInstStruct) (int, bool) {
 	espXmlmc.SetParam("reportId", strconv.Itoa(report.ReportID))
 	espXmlmc.SetParam("comment", "Run from the goHornbillReport tool")
+	runParams := reportRunParameters(report, time.Now())
+	setRunParameters(espXmlmc, runParams)
+	if len(runParams) > 0 {
+		logger(3, "Runtime Parameters: "+parameterFlags(runParams).String(), true)
+	}
 
 	XMLMC, xmlmcErr := espXmlmc.Invoke("reporting", "reportRun")
 	if xmlmcErr != nil {
-		hornbillHelpers.Logger(4, xmlmcErr.Error(), true, logFile)
-		return
+		logger(4, xmlmcErr.Error(), true)
+		return 0, false
 	}
 
 	var xmlRespon xmlmcReportResponse
 
 	err := xml.Unmarshal([]byte(XMLMC), &xmlRespon)
 	if err != nil {
-		hornbillHelpers.Logger(4, fmt.Sprintf("%v", err), true, logFile)
-		return
+		logger(4, fmt.Sprintf("%v", err), true)
+		return 0, false
 	}
 	if xmlRespon.MethodResult != "ok" {
-		hornbillHelpers.Logger(4, xmlRespon.State.ErrorRet, true, logFile)
-		return
+		logger(4, xmlRespon.State.ErrorRet, true)
+		return 0, false
+	}
+	if xmlRespon.RunID <= 0 {
+		logger(4, "No RunID returned from ", true)
+		return 0, false
+	}
+	return xmlRespon.RunID, true
+}
+
+// waitForReport -- Polls the report run until it completes, every PollInterval seconds of the report, multiplying
+// -- the interval by PollBackoff after each check up to MaxPollInterval seconds. Runs still going after RunTimeout
+// -- seconds are abandoned, and deleted from the instance when CancelOnTimeout is set.
+// -- Returns false if the run failed or timed out, along with true if the run has ended on the instance
+func waitForReport(runID int, report reportStruct, espXmlmc *apiLib.XmlmcInstStruct) (paramsReportStruct, bool, bool) {
+	pollInterval := time.Second * time.Duration(defaultPollInterval)
+	if report.PollInterval > 0 {
+		pollInterval = time.Second * time.Duration(report.PollInterval)
+	}
+	maxPollInterval := time.Second * time.Duration(defaultMaxPollInterval)
+	if report.MaxPollInterval > 0 {
+		maxPollInterval = time.Second * time.Duration(report.MaxPollInterval)
 	}
-	if xmlRespon.RunID > 0 {
-		reportComplete := false
-		for !reportComplete {
-			reportSuccess, reportComplete, reportDetails := checkReport(xmlRespon.RunID, espXmlmc)
-
-			if reportComplete {
-				if !reportSuccess {
-					return
-				}
-				getReportContent(reportDetails, espXmlmc, report)
-				if report.DeleteReportInstance {
-					deleteReportInstance(reportDetails.ReportRun.RunID)
-				}
-				return
+	if maxPollInterval < pollInterval {
+		maxPollInterval = pollInterval
+	}
+	var runDeadline time.Time
+	if report.RunTimeout > 0 {
+		runDeadline = time.Now().Add(time.Second * time.Duration(report.RunTimeout))
+	}
+
+	for {
+		reportSuccess, reportComplete, runEnded, reportDetails := checkReport(runID, espXmlmc)
+		if reportComplete {
+			return reportDetails, reportSuccess, runEnded
+		}
+		if !runDeadline.IsZero() && !time.Now().Before(runDeadline) {
+			logger(4, "Report Run ID ["+strconv.Itoa(runID)+"] Timed Out after "+strconv.Itoa(report.RunTimeout)+" seconds", true)
+			if report.CancelOnTimeout {
+				deleteReportInstance(runID, espXmlmc)
+			}
+			return paramsReportStruct{}, false, report.CancelOnTimeout
+		}
+
+		sleep := pollInterval
+		if !runDeadline.IsZero() && time.Until(runDeadline) < sleep {
+			sleep = time.Until(runDeadline)
+		}
+		time.Sleep(sleep)
+		if report.PollBackoff > 1 {
+			pollInterval = time.Duration(float64(pollInterval) * report.PollBackoff)
+			if pollInterval > maxPollInterval {
+				pollInterval = maxPollInterval
 			}
-			time.Sleep(time.Second * 3)
 		}
-	} else {
-		hornbillHelpers.Logger(4, "No RunID returned from ", true, logFile)
-		return
 	}
 }
 
-func checkReport(runID int, espXmlmc *apiLib.XmlmcInstStruct) (bool, bool, paramsReportStruct) {
+// checkReport -- Gets the status of the report run. Returns true if the run completed successfully, true if it
+// -- has finished being checked, and true if the run has ended on the instance. Runs the instance returns an error
+// -- for, such as those that no longer exist, have ended. Runs that could not be checked may still be going
+func checkReport(runID int, espXmlmc *apiLib.XmlmcInstStruct) (bool, bool, bool, paramsReportStruct) {
 
-	hornbillHelpers.Logger(3, "Checking Report Run ID ["+strconv.Itoa(runID)+"] for completion...", true, logFile)
+	logger(3, "Checking Report Run ID ["+strconv.Itoa(runID)+"] for completion...", true)
 	espXmlmc.SetParam("runId", strconv.Itoa(runID))
 	XMLMC, xmlmcErr := espXmlmc.Invoke("reporting", "reportRunGetStatus")
 
 	if xmlmcErr != nil {
-		hornbillHelpers.Logger(4, xmlmcErr.Error(), true, logFile)
-		return false, true, paramsReportStruct{}
+		logger(4, xmlmcErr.Error(), true)
+		return false, true, false, paramsReportStruct{}
 	}
 
 	var xmlRespon xmlmcReportStatusResponse
 
 	err := xml.Unmarshal([]byte(XMLMC), &xmlRespon)
 	if err != nil {
-		hornbillHelpers.Logger(4, fmt.Sprintf("%v", err), true, logFile)
-		return false, true, paramsReportStruct{}
+		logger(4, fmt.Sprintf("%v", err), true)
+		return false, true, false, paramsReportStruct{}
 	}
 	if xmlRespon.MethodResult != "ok" {
-		hornbillHelpers.Logger(4, xmlRespon.State.ErrorRet, true, logFile)
-		return false, true, paramsReportStruct{}
+		logger(4, xmlRespon.State.ErrorRet, true)
+		return false, true, true, paramsReportStruct{}
 	}
 
 	switch xmlRespon.Params.ReportRun.Status {
@@ -175,78 +327,414 @@ func checkReport(runID int, espXmlmc *apiLib.XmlmcInstStruct) (bool, bool, param
 	case "started":
 		fallthrough
 	case "running":
-		return false, false, paramsReportStruct{}
+		return false, false, false, paramsReportStruct{}
 	case "completed":
-		return true, true, xmlRespon.Params
+		return true, true, true, xmlRespon.Params
 	case "failed":
 		fallthrough
 	case "aborted":
-		return false, true, paramsReportStruct{}
+		logger(4, "Report Run ID ["+strconv.Itoa(runID)+"] "+xmlRespon.Params.ReportRun.Status, true)
+		return false, true, true, xmlRespon.Params
 	}
-	return false, false, paramsReportStruct{}
+	//-- Unknown statuses are treated as failed, rather than polled indefinitely
+	logger(4, "Report Run ID ["+strconv.Itoa(runID)+"] returned an unknown status: "+xmlRespon.Params.ReportRun.Status, true)
+	return false, true, true, xmlRespon.Params
 }
 
-func getReportContent(reportOutput paramsReportStruct, espXmlmc *apiLib.XmlmcInstStruct, report reportStruct) {
+// getReportContent -- Retrieves the files output by the report run and delivers their records to the report destinations.
+// -- Files already processed, or retrieved, by an earlier invocation recorded in the state are not processed, or retrieved, again
+// -- Returns false if any file could not be delivered or breached the report failure thresholds
+func getReportContent(reportOutput paramsReportStruct, espXmlmc *apiLib.XmlmcInstStruct, report reportStruct, state *reportStateStruct) bool {
+	reportSuccess := true
+	destinations := reportDestinations(report)
 	for _, v := range reportOutput.Files {
-		var counters counterStruct
-		reportFile := ""
-		if !report.UseXLSX && v.Type == "csv" {
-			reportFile = getFile(reportOutput.ReportRun, v, espXmlmc, report)
-		} else if report.UseXLSX && v.Type == "xlsx" {
-			reportFile = getFile(reportOutput.ReportRun, v, espXmlmc, report)
-		}
-		if reportFile != "" && !configSkipInsert {
-			success := false
-			var csvMap []map[string]string
-			if report.UseXLSX {
-				success, csvMap = getRecordsFromXLSX(reportFile)
-			} else {
-				success, csvMap = getRecordsFromCSV(reportFile)
-			}
-			if success {
-				totalRecords := len(csvMap)
-				if totalRecords == 0 {
-					hornbillHelpers.Logger(3, "No records found within "+v.Name+"...", true, logFile)
-				} else {
-					hornbillHelpers.Logger(3, "Processing "+strconv.Itoa(totalRecords)+" Records from "+v.Name+"...", true, logFile)
-					bar := pb.StartNew(totalRecords)
-					for _, reportRow := range csvMap {
-						upsertRecord(reportRow, report, &counters)
-						bar.Increment()
-					}
-					bar.Finish()
-					hornbillHelpers.Logger(3, "Processing Complete", true, logFile)
-					hornbillHelpers.Logger(3, "====Report Processing Statistics====", true, logFile)
-					hornbillHelpers.Logger(3, " * "+report.ReportName+" ["+strconv.Itoa(report.ReportID)+"]", true, logFile)
-					hornbillHelpers.Logger(3, " * Total Records Found: "+strconv.Itoa(totalRecords), true, logFile)
-					hornbillHelpers.Logger(3, " * Rows Affected: "+strconv.Itoa(counters.rowsaffected), true, logFile)
-					hornbillHelpers.Logger(3, " * Successful Queries: "+strconv.Itoa(counters.success), true, logFile)
-
-					failedQueryOutput := " * Failed Queries: " + strconv.Itoa(counters.failed)
-					if counters.failed > 0 {
-						hornbillHelpers.Logger(3, failedQueryOutput, false, logFile)
-						color.Red(failedQueryOutput)
-					} else {
-						hornbillHelpers.Logger(3, failedQueryOutput, true, logFile)
-					}
-				}
+		if !reportFileWanted(report, v) {
+			continue
+		}
+		if state.fileCompleted(v.Name) {
+			logger(3, "Skipping "+v.Name+", already processed", true)
+			continue
+		}
+		downloadedFile := state.downloadedFile(v.Name)
+		if downloadedFile != "" {
+			logger(3, "Using "+downloadedFile+", already retrieved", true)
+		} else {
+			downloadedFile = getFile(reportOutput.ReportRun, v, espXmlmc, report)
+			if downloadedFile == "" {
+				continue
 			}
-			if report.DeleteReportLocalFile {
+			state.setDownloaded(v.Name, downloadedFile)
+		}
+		if len(destinations) == 0 {
+			continue
+		}
+		if !processLocalFile(downloadedFile, filepath.Dir(downloadedFile), reportOutput.ReportRun.RunID, report, destinations, report.DeleteReportLocalFile, state) {
+			reportSuccess = false
+			continue
+		}
+		state.setFileCompleted(v.Name)
+	}
+	return reportSuccess
+}
+
+// processLocalFile -- Decompresses the local report file in to the extract folder if needed, then delivers each
+// -- report file it holds to the destinations. The local files are removed afterwards when deleteLocal is set
+func processLocalFile(localFile, extractFolder string, runID int, report reportStruct, destinations []destinationStruct, deleteLocal bool, state *reportStateStruct) bool {
+	//-- Deliver the report file as downloaded, before it is decompressed or any records are processed
+	fileDestinations, _ := splitDestinations(destinations)
+	rawOutput := outputContext{
+		Report:   report,
+		RunID:    runID,
+		FileName: filepath.Base(localFile),
+		RunDate:  time.Now(),
+		State:    state,
+	}
+	if !deliverFiles(fileDestinations, []string{localFile}, rawOutput, false) {
+		if deleteLocal {
+			deleteFile(localFile)
+		}
+		return false
+	}
+
+	reportFiles, extracted := extractReportFile(localFile, extractFolder, report)
+	if !extracted {
+		if deleteLocal {
+			deleteFile(localFile)
+		}
+		return false
+	}
+	success := true
+	for _, reportFile := range reportFiles {
+		table, matched := reportFileTable(report, filepath.Base(reportFile))
+		if !matched {
+			logger(3, "Skipping "+filepath.Base(reportFile)+", it does not match any of the report Files patterns", true)
+			if deleteLocal {
 				deleteFile(reportFile)
 			}
+			continue
+		}
+		fileReport := report
+		fileReport.Table = table
+		output := outputContext{
+			Report:   fileReport,
+			RunID:    runID,
+			FileName: filepath.Base(reportFile),
+			RunDate:  time.Now(),
+			State:    state,
+		}
+		if !processReportFile(reportFile, output, destinations) {
+			success = false
+		}
+		if deleteLocal {
+			deleteFile(reportFile)
+		}
+	}
+	if deleteLocal && (len(reportFiles) != 1 || reportFiles[0] != localFile) {
+		deleteFile(localFile)
+	}
+	return success
+}
+
+// reportFileTable -- Returns the table definition for a report file. Reports without Files patterns use the
+// -- report Table for every file. Otherwise the Table of the first pattern matching the file name is used,
+// -- or the report Table if that pattern has no TableName. Returns false if no pattern matches
+func reportFileTable(report reportStruct, fileName string) (dbConfigStruct, bool) {
+	if len(report.Files) == 0 {
+		return report.Table, true
+	}
+	for _, file := range report.Files {
+		matched, err := filepath.Match(strings.ToLower(file.Pattern), strings.ToLower(fileName))
+		if err != nil {
+			logger(4, "Invalid Files pattern "+file.Pattern+": "+fmt.Sprintf("%v", err), false)
+			continue
+		}
+		if !matched {
+			continue
+		}
+		if file.Table.TableName == "" {
+			return report.Table, true
+		}
+		return file.Table, true
+	}
+	return dbConfigStruct{}, false
+}
+
+// processReportFile -- Delivers the records parsed from a local report file to each of the record destinations,
+// -- then delivers any files written by them to the file destinations with UploadTransformed set
+// -- Returns false if a destination failed or the report failure thresholds were breached
+func processReportFile(reportFile string, output outputContext, destinations []destinationStruct) bool {
+	fileDestinations, recordDestinations := splitDestinations(destinations)
+	if len(recordDestinations) == 0 {
+		return true
+	}
+
+	sources, success := reportSources(reportFile, output)
+	if !success {
+		return false
+	}
+	outputFiles := []string{}
+	for _, source := range sources {
+		sourceSuccess, sourceFiles := deliverRecords(reportFile, source, recordDestinations)
+		if !sourceSuccess {
+			success = false
+		}
+		outputFiles = append(outputFiles, sourceFiles...)
+	}
+	if !deliverFiles(fileDestinations, outputFiles, output, true) {
+		success = false
+	}
+	return success
+}
+
+// deliverRecords -- Parses a local report file and writes its records to each of the record destinations
+// -- Returns false if a destination failed or the report failure thresholds were breached,
+// -- along with any files written by the destinations
+func deliverRecords(reportFile string, output outputContext, destinations []destinationStruct) (bool, []string) {
+	var counters counterStruct
+	report := output.Report
+
+	reader, success := openRecordReader(reportFile, output)
+	if !success {
+		return false, nil
+	}
+	defer reader.Close()
+	output.Header = reader.Header()
+	output.Report.Table = resolveMapping(report.Table, output.Header)
+	report = output.Report
+	if !checkMapping(report.Table, output.Header, output.FileName) && report.StrictMapping {
+		logger(4, "Report columns do not match the table mapping, "+output.FileName+" not processed", true)
+		return false, nil
+	}
+	totalRecords := reader.Total()
+	if totalRecords == 0 {
+		logger(3, "No records found within "+output.FileName+"...", true)
+		return true, nil
+	}
+
+	validator, err := newRecordValidator(report.Table)
+	if err != nil {
+		logger(4, "Error in table Validation: "+fmt.Sprintf("%v", err), true)
+		return false, nil
+	}
+
+	sinks, sinksOpen := openSinks(destinations, output)
+	defer closeSinks(sinks)
+	if !sinksOpen {
+		return false, nil
+	}
+
+	logger(3, "Processing "+strconv.Itoa(totalRecords)+" Records from "+output.FileName+"...", true)
+	bar := pb.New(totalRecords)
+	//-- Progress bars of concurrent reports would overwrite each other
+	bar.NotPrint = configConcurrency > 1
+	bar.Start()
+	thresholdExceeded := false
+	sinkFailed := false
+	readFailed := false
+
+	//-- Records delivered by an earlier invocation of the tool are skipped for the destinations that deliver
+	//-- records outside of the tool. Other destinations, such as files, are written from the first record again
+	resumeFrom := output.State.rowsLoaded(output.FileName)
+	restartSinks := []sink{}
+	for _, s := range sinks {
+		if _, ok := s.(resumableSink); !ok {
+			restartSinks = append(restartSinks, s)
+		}
+	}
+	if resumeFrom > 0 {
+		logger(3, "Resuming from record "+strconv.Itoa(resumeFrom+1)+", earlier records already delivered", true)
+	}
+
+	//-- Records are passed to the destinations one at a time when aborting on failure, so the
+	//-- failure thresholds are checked after each record rather than after each batch
+	batchSize := sinkBatchSize
+	if report.AbortOnFailure {
+		batchSize = 1
+	}
+	batch := make([]map[string]string, 0, batchSize)
+	batchSinks := sinks
+	rowsRead := 0
+	for !sinkFailed && !thresholdExceeded && !readFailed {
+		reportRow, err := reader.Read()
+		if err != nil && err != io.EOF {
+			logger(4, "Error reading report data: "+fmt.Sprintf("%v", err), true)
+			readFailed = true
+			break
+		}
+		rowSinks := sinks
+		if err == nil && rowsRead < resumeFrom {
+			rowSinks = restartSinks
+		}
+
+		//-- Write the batch when full, at the end of the file, or once the records already delivered have been read
+		if len(batch) > 0 && (err == io.EOF || len(batch) >= batchSize || len(rowSinks) != len(batchSinks)) {
+			if !writeSinks(batchSinks, batch, &counters) {
+				sinkFailed = true
+				break
+			}
+			bar.Add(len(batch))
+			batch = batch[:0]
+			if len(batchSinks) == len(sinks) {
+				saveRowsDelivered(output, sinks, counters, rowsRead)
+			}
+			thresholdExceeded = report.AbortOnFailure && failureThresholdExceeded(report, counters, totalRecords)
+			if thresholdExceeded {
+				break
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+
+		rowsRead++
+		if len(rowSinks) == 0 {
+			bar.Increment()
+			continue
+		}
+		if failedRule := validator.validate(reportRow); failedRule != "" {
+			logRejectedRecord(failedRule, reportRow)
+			counters.rejected++
+			bar.Increment()
+			continue
+		}
+		batch = append(batch, reportRow)
+		batchSinks = rowSinks
+	}
+	bar.Finish()
+	counters.malformed = reader.Malformed()
+	if !sinkFailed && !readFailed {
+		if commitSinks(sinks, &counters) {
+			saveRowsDelivered(output, sinks, counters, rowsRead)
+		} else {
+			sinkFailed = true
+		}
+	}
+
+	if readFailed {
+		logger(4, "Reading report file failed, remaining records aborted", true)
+	} else if sinkFailed {
+		logger(4, "Delivery to report destination failed, remaining records aborted", true)
+	} else if thresholdExceeded {
+		logger(4, "Failure threshold exceeded, remaining records aborted", true)
+	} else {
+		logger(3, "Processing Complete", true)
+	}
+	logger(3, "====Report Processing Statistics====", true)
+	logger(3, " * "+report.ReportName+" ["+strconv.Itoa(report.ReportID)+"]", true)
+	logger(3, " * Total Records Found: "+strconv.Itoa(totalRecords), true)
+	malformedOutput := " * Malformed Records: " + strconv.Itoa(counters.malformed)
+	if counters.malformed > 0 {
+		logger(3, malformedOutput, false)
+		color.Red(malformedOutput)
+	} else {
+		logger(3, malformedOutput, true)
+	}
+	rejectedOutput := " * Rejected Records: " + strconv.Itoa(counters.rejected)
+	if counters.rejected > 0 {
+		logger(3, rejectedOutput, false)
+		color.Red(rejectedOutput)
+	} else {
+		logger(3, rejectedOutput, true)
+	}
+	logger(3, " * Rows Affected: "+strconv.Itoa(counters.rowsaffected), true)
+	logger(3, " * Successful Queries: "+strconv.Itoa(counters.success), true)
+
+	failedQueryOutput := " * Failed Queries: " + strconv.Itoa(counters.failed)
+	if counters.failed > 0 {
+		logger(3, failedQueryOutput, false)
+		color.Red(failedQueryOutput)
+	} else {
+		logger(3, failedQueryOutput, true)
+	}
+	batchLabels := []string{}
+	for label := range counters.batches {
+		batchLabels = append(batchLabels, label)
+	}
+	sort.Strings(batchLabels)
+	for _, label := range batchLabels {
+		batchCounters := counters.batches[label]
+		logger(3, " * "+label+" Records Sent: "+strconv.Itoa(batchCounters.records), true)
+		logger(3, " * "+label+" Successful Batches: "+strconv.Itoa(batchCounters.success), true)
+		failedBatchOutput := " * " + label + " Failed Batches: " + strconv.Itoa(batchCounters.failed)
+		if batchCounters.failed > 0 {
+			logger(3, failedBatchOutput, false)
+			color.Red(failedBatchOutput)
+		} else {
+			logger(3, failedBatchOutput, true)
+		}
+	}
+
+	if sinkFailed || readFailed {
+		return false, nil
+	}
+	outputFiles := sinkOutputFiles(sinks)
+	if failureThresholdExceeded(report, counters, totalRecords) {
+		failedReportOutput := " * Report Failed: failure threshold exceeded"
+		logger(4, failedReportOutput, false)
+		color.Red(failedReportOutput)
+		return false, outputFiles
+	}
+	return true, outputFiles
+}
+
+// saveRowsDelivered -- Records in the report state that the records read so far have been delivered, so a resumed
+// -- run can skip them. The state is only moved on while no records have failed and no destination is holding
+// -- records it has yet to deliver, so records that were not delivered are always delivered again
+func saveRowsDelivered(output outputContext, sinks []sink, counters counterStruct, rowsRead int) {
+	if output.State == nil || counters.failedRecords() > 0 || rowsRead <= output.State.rowsLoaded(output.FileName) {
+		return
+	}
+	for _, s := range sinks {
+		if resumable, ok := s.(resumableSink); ok && resumable.Pending() > 0 {
+			return
+		}
+	}
+	output.State.setRowsLoaded(output.FileName, rowsRead)
+}
 
+// failureThresholdExceeded -- Checks the failed record count against the report MaxFailedRows and MaxFailedPercent settings
+func failureThresholdExceeded(report reportStruct, counters counterStruct, totalRecords int) bool {
+	failedRecords := counters.failedRecords()
+	if report.MaxFailedRows != nil && failedRecords > *report.MaxFailedRows {
+		return true
+	}
+	if report.MaxFailedPercent != nil && totalRecords > 0 {
+		failedPercent := float64(failedRecords) / float64(totalRecords) * 100
+		if failedPercent > *report.MaxFailedPercent {
+			return true
 		}
 	}
+	return false
+}
+
+// failedRecords - returns the failed database queries plus the records in failed destination batches
+func (c counterStruct) failedRecords() int {
+	failed := c.failed
+	for _, batchCounters := range c.batches {
+		failed += batchCounters.failedRecords
+	}
+	return failed
+}
+
+// batch - returns the batch statistics for the labelled destination, creating them if needed
+func (c *counterStruct) batch(label string) *batchCounterStruct {
+	if c.batches == nil {
+		c.batches = make(map[string]*batchCounterStruct)
+	}
+	if c.batches[label] == nil {
+		c.batches[label] = &batchCounterStruct{}
+	}
+	return c.batches[label]
 }
 
 func getFile(reportRun reportRunStruct, file reportFileStruct, espXmlmc *apiLib.XmlmcInstStruct, report reportStruct) string {
-	hornbillHelpers.Logger(3, "Retrieving "+strings.ToUpper(file.Type)+" Report File "+file.Name+"...", true, logFile)
+	logger(3, "Retrieving "+strings.ToUpper(file.Type)+" Report File "+file.Name+"...", true)
 
 	cwd, _ := os.Getwd()
 	reportsFolder := path.Join(cwd, "reports")
 	//-- If reports folder doesn't dxist then create it
 	if _, err := os.Stat(reportsFolder); os.IsNotExist(err) {
-		err := os.Mkdir(reportsFolder, 0777)
+		err := os.MkdirAll(reportsFolder, 0777)
 		if err != nil {
 			color.Red("Error Creating Reports Folder %q: %s \r", reportsFolder, err)
 			os.Exit(2)
@@ -257,81 +745,104 @@ func getFile(reportRun reportRunStruct, file reportFileStruct, espXmlmc *apiLib.
 	reportPath := path.Join(reportsFolder, file.Name)
 	out, err := os.Create(reportPath)
 	if err != nil {
-		hornbillHelpers.Logger(4, file.Name+" Report File Creation Failed: "+fmt.Sprintf("%v", err), true, logFile)
+		logger(4, file.Name+" Report File Creation Failed: "+fmt.Sprintf("%v", err), true)
 		return ""
 	}
 	defer out.Close()
 
 	reportURL := davEndpoint + "reports/" + strconv.Itoa(reportRun.ReportID) + "/" + file.Name
-	hornbillHelpers.Logger(3, "Report File URL: "+reportURL, false, logFile)
+	logger(3, "Report File URL: "+reportURL, false)
 
 	req, err := http.NewRequest("GET", reportURL, nil)
 	req.Header.Set("Content-Type", "text/csv; charset=utf-8")
 	req.Header.Set("Authorization", "ESP-APIKEY "+apiCallConfig.APIKey)
 	req.Header.Set("User-Agent", "Go-http-client/1.1")
+	req.Header.Set("Accept-Encoding", "gzip")
 
 	if err != nil {
-		hornbillHelpers.Logger(4, "httpNewRequest Error: "+fmt.Sprintf("%v", err), true, logFile)
+		logger(4, "httpNewRequest Error: "+fmt.Sprintf("%v", err), true)
 		return ""
 	}
 
-	duration := time.Second * time.Duration(configTimeout)
-
-	var netTransport = &http.Transport{
-		Proxy: http.ProxyFromEnvironment,
-		Dial: (&net.Dialer{
-			Timeout: duration,
-		}).Dial,
-		TLSHandshakeTimeout: 10 * time.Second,
-	}
-
-	client := &http.Client{
-		Timeout:   duration,
-		Transport: netTransport,
-	}
+	client := newHTTPClient(time.Second * time.Duration(configTimeout))
 
 	resp, err := client.Do(req)
 	if err != nil {
-		hornbillHelpers.Logger(4, "client.Do Error: "+fmt.Sprintf("%v", err), true, logFile)
+		logger(4, "client.Do Error: "+fmt.Sprintf("%v", err), true)
 		return ""
 	}
 	defer resp.Body.Close()
 
 	//-- Check for HTTP Response
 	if resp.StatusCode != 200 {
-		hornbillHelpers.Logger(4, fmt.Sprintf("Invalid HTTP Response: %d", resp.StatusCode), true, logFile)
+		logger(4, fmt.Sprintf("Invalid HTTP Response: %d", resp.StatusCode), true)
 		io.Copy(io.Discard, resp.Body)
 		return ""
 	}
 
 	// Create progress reporter, and pass it to be used with writer
 	counter := &WriteCounter{FileName: file.Name}
-	_, errCopy := io.Copy(out, io.TeeReader(resp.Body, counter))
+	var body io.Reader = io.TeeReader(resp.Body, counter)
+
+	//-- Decompress the response when the server has used gzip transfer encoding
+	if strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip") {
+		gzipReader, err := gzip.NewReader(body)
+		if err != nil {
+			logger(4, "gzip.NewReader Error: "+fmt.Sprintf("%v", err), true)
+			return ""
+		}
+		defer gzipReader.Close()
+		body = gzipReader
+	}
+	_, errCopy := io.Copy(out, body)
 	if errCopy != nil {
-		hornbillHelpers.Logger(4, "io.Copy Error: "+fmt.Sprintf("%v", errCopy), true, logFile)
+		logger(4, "io.Copy Error: "+fmt.Sprintf("%v", errCopy), true)
 		return ""
 	}
-	fmt.Print("\n")
+	if configConcurrency <= 1 {
+		fmt.Print("\n")
+	}
 
-	hornbillHelpers.Logger(3, "Retrieved report data from "+reportPath, false, logFile)
+	logger(3, "Retrieved report data from "+reportPath, false)
 	return reportPath
 }
 
+// newHTTPClient -- Returns a HTTP client that honours the proxy environment variables
+// -- A timeout of 0 allows requests to run for as long as the transfer takes
+func newHTTPClient(timeout time.Duration) *http.Client {
+	dialTimeout := timeout
+	if dialTimeout == 0 {
+		dialTimeout = time.Second * time.Duration(configTimeout)
+	}
+	var netTransport = &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		Dial: (&net.Dialer{
+			Timeout: dialTimeout,
+		}).Dial,
+		TLSHandshakeTimeout: 10 * time.Second,
+	}
+
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: netTransport,
+	}
+}
+
 func deleteFile(filePath string) {
-	hornbillHelpers.Logger(3, "Deleting Report Local File...", true, logFile)
+	logger(3, "Deleting Report Local File...", true)
 	err := os.Remove(filePath)
 	if err != nil {
-		hornbillHelpers.Logger(4, "Error deleting file:"+fmt.Sprintf("%v", err), false, logFile)
+		logger(4, "Error deleting file:"+fmt.Sprintf("%v", err), false)
 		return
 	}
 }
-func deleteReportInstance(runID int) {
-	hornbillHelpers.Logger(3, "Deleting Report Run Instance...", true, logFile)
+func deleteReportInstance(runID int, espXmlmc *apiLib.XmlmcInstStruct) {
+	logger(3, "Deleting Report Run Instance...", true)
 	espXmlmc.SetParam("runId", strconv.Itoa(runID))
 	XMLMC, xmlmcErr := espXmlmc.Invoke("reporting", "reportRunDelete")
 
 	if xmlmcErr != nil {
-		hornbillHelpers.Logger(4, xmlmcErr.Error(), true, logFile)
+		logger(4, xmlmcErr.Error(), true)
 		return
 	}
 
@@ -339,11 +850,11 @@ func deleteReportInstance(runID int) {
 
 	err := xml.Unmarshal([]byte(XMLMC), &xmlRespon)
 	if err != nil {
-		hornbillHelpers.Logger(4, fmt.Sprintf("%v", err), true, logFile)
+		logger(4, fmt.Sprintf("%v", err), true)
 		return
 	}
 	if xmlRespon.MethodResult != "ok" {
-		hornbillHelpers.Logger(4, xmlRespon.State.ErrorRet, true, logFile)
+		logger(4, xmlRespon.State.ErrorRet, true)
 		return
 	}
 }
@@ -354,16 +865,16 @@ func loadConfig() (apiCallStruct, bool) {
 	//-- Check Config File File Exists
 	cwd, _ := os.Getwd()
 	configurationFilePath := path.Join(cwd, configFileName)
-	hornbillHelpers.Logger(1, "Loading Config File: "+configurationFilePath, false, logFile)
+	logger(1, "Loading Config File: "+configurationFilePath, false)
 	if _, fileCheckErr := os.Stat(configurationFilePath); os.IsNotExist(fileCheckErr) {
-		hornbillHelpers.Logger(4, "No Configuration File", true, logFile)
+		logger(4, "No Configuration File", true)
 		os.Exit(102)
 	}
 	//-- Load Config File
 	file, fileError := os.Open(configurationFilePath)
 	//-- Check For Error Reading File
 	if fileError != nil {
-		hornbillHelpers.Logger(4, "Error Opening Configuration File: "+fmt.Sprintf("%v", fileError), true, logFile)
+		logger(4, "Error Opening Configuration File: "+fmt.Sprintf("%v", fileError), true)
 		boolLoadConf = false
 	}
 
@@ -375,7 +886,7 @@ func loadConfig() (apiCallStruct, bool) {
 	err := decoder.Decode(&edbConf)
 	//-- Error Checking
 	if err != nil {
-		hornbillHelpers.Logger(4, "Error Decoding Configuration File: "+fmt.Sprintf("%v", err), true, logFile)
+		logger(4, "Error Decoding Configuration File: "+fmt.Sprintf("%v", err), true)
 		boolLoadConf = false
 	}
 	//-- Return New Config
@@ -386,7 +897,10 @@ func loadConfig() (apiCallStruct, bool) {
 func (wc *WriteCounter) Write(p []byte) (int, error) {
 	n := len(p)
 	wc.Total += uint64(n)
-	wc.PrintProgress()
+	//-- Download progress of concurrent reports would overwrite each other
+	if configConcurrency <= 1 {
+		wc.PrintProgress()
+	}
 	return n, nil
 }
 
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const (
+	httpDefaultBatchSize  = 100
+	httpDefaultMaxRetries = 3
+	httpDefaultRetryDelay = 1
+)
+
+// httpSink - POSTs the mapped report records to a HTTP endpoint as JSON arrays
+type httpSink struct {
+	destination destinationStruct
+	table       dbConfigStruct
+	client      *http.Client
+	label       string
+	batch       []map[string]string
+}
+
+func newHTTPSink(destination destinationStruct) sink {
+	return &httpSink{destination: destination}
+}
+
+// Open - checks the endpoint is configured
+func (s *httpSink) Open(output outputContext) error {
+	if s.destination.URL == "" {
+		return errors.New("no URL specified")
+	}
+	s.table = output.Report.Table
+	s.client = newHTTPClient(time.Second * time.Duration(configTimeout))
+	s.label = "HTTP " + displayURL(s.destination.URL)
+	return nil
+}
+
+// WriteBatch - buffers the mapped records, sending them each time the destination BatchSize is reached
+func (s *httpSink) WriteBatch(rows []map[string]string, counters *counterStruct) error {
+	for _, reportRow := range rows {
+		s.batch = append(s.batch, mapRecord(reportRow, s.table))
+		if len(s.batch) >= destinationBatchSize(s.destination) {
+			s.sendBatch(counters)
+		}
+	}
+	return nil
+}
+
+// Commit - sends any records remaining in the buffer
+func (s *httpSink) Commit(counters *counterStruct) error {
+	if len(s.batch) > 0 {
+		s.sendBatch(counters)
+	}
+	return nil
+}
+
+// Pending - returns the number of buffered records not yet sent
+func (s *httpSink) Pending() int {
+	return len(s.batch)
+}
+
+// Close - nothing to release, the HTTP client is discarded with the sink
+func (s *httpSink) Close() error {
+	return nil
+}
+
+// sendBatch - POSTs the buffered records and records the outcome in the batch statistics
+func (s *httpSink) sendBatch(counters *counterStruct) {
+	batchCounters := counters.batch(s.label)
+	batchSize := len(s.batch)
+	payload, err := json.Marshal(s.batch)
+	s.batch = s.batch[:0]
+	if err == nil {
+		_, err = sendWithRetry(s.client, s.destination, "POST", s.destination.URL, "application/json", payload)
+	}
+	if err != nil {
+		logger(4, s.label+" Batch Failed: "+fmt.Sprintf("%v", err), false)
+		batchCounters.failed++
+		batchCounters.failedRecords += batchSize
+		return
+	}
+	batchCounters.success++
+	batchCounters.records += batchSize
+}
+
+// displayURL -- Returns the scheme, host and path of the URL for the statistics and log, leaving out
+// -- any credentials or query string it holds
+func displayURL(rawURL string) string {
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil || parsedURL.Host == "" {
+		return "destination"
+	}
+	return parsedURL.Scheme + "://" + parsedURL.Host + parsedURL.Path
+}
+
+// destinationBatchSize -- Returns the number of records the destination should receive in each request
+func destinationBatchSize(destination destinationStruct) int {
+	if destination.BatchSize > 0 {
+		return destination.BatchSize
+	}
+	return httpDefaultBatchSize
+}
+
+// sendWithRetry -- Sends the payload to the URL with the destination headers and credentials.
+// -- Requests that fail to connect or receive a 5xx response are retried up to MaxRetries times,
+// -- doubling the RetryDelay (in seconds) between each attempt. Returns the response body
+func sendWithRetry(client *http.Client, destination destinationStruct, method, url, contentType string, payload []byte) ([]byte, error) {
+	maxRetries := httpDefaultMaxRetries
+	if destination.MaxRetries != nil {
+		maxRetries = *destination.MaxRetries
+	}
+	retryDelay := time.Second * time.Duration(httpDefaultRetryDelay)
+	if destination.RetryDelay > 0 {
+		retryDelay = time.Second * time.Duration(destination.RetryDelay)
+	}
+
+	var lastErr error
+	for attempt := 0; attempt <= maxRetries; attempt++ {
+		if attempt > 0 {
+			if configDebug {
+				logger(1, "Retrying "+displayURL(url)+" in "+retryDelay.String()+" (attempt "+strconv.Itoa(attempt+1)+")", false)
+			}
+			time.Sleep(retryDelay)
+			retryDelay *= 2
+		}
+
+		req, err := http.NewRequest(method, url, bytes.NewReader(payload))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", contentType)
+		req.Header.Set("User-Agent", "Go-http-client/1.1")
+		if destination.Token != "" {
+			req.Header.Set("Authorization", "Bearer "+destination.Token)
+		} else if destination.UserName != "" {
+			req.SetBasicAuth(destination.UserName, destination.Password)
+		}
+		for name, value := range destination.Headers {
+			req.Header.Set(name, value)
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if resp.StatusCode >= 500 {
+			lastErr = fmt.Errorf("invalid HTTP response: %d", resp.StatusCode)
+			continue
+		}
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return body, fmt.Errorf("invalid HTTP response: %d %s", resp.StatusCode, string(bytes.TrimSpace(body)))
+		}
+		return body, nil
+	}
+	return nil, lastErr
+}
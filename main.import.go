@@ -0,0 +1,93 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// importReportDefinition -- Returns the report definition named by the -report flag, matching either
+// -- the report ID or name. The flag can be left out when the configuration holds a single report
+func importReportDefinition() (reportStruct, bool) {
+	if configReport == "" {
+		if len(apiCallConfig.Reports) == 1 {
+			return apiCallConfig.Reports[0], true
+		}
+		logger(4, "The -report flag is required with -import when the configuration holds more than one report", true)
+		return reportStruct{}, false
+	}
+	for _, report := range apiCallConfig.Reports {
+		if strconv.Itoa(report.ReportID) == configReport || strings.EqualFold(report.ReportName, configReport) {
+			return report, true
+		}
+	}
+	logger(4, "No report definition found in the configuration for "+configReport, true)
+	return reportStruct{}, false
+}
+
+// importReportFiles -- Delivers the records of a local report file, or of each report file in a folder,
+// -- to the report destinations without running the report on the instance.
+// -- Imported files are never removed, whatever the DeleteReportLocalFile setting of the report. Compressed files
+// -- are extracted to a temporary folder that is removed once they are imported, so the import folder is unchanged
+func importReportFiles(importPath string, report reportStruct) bool {
+	logger(3, " ", true)
+	logger(3, "Importing Report Files for: "+report.ReportName+" ["+strconv.Itoa(report.ReportID)+"]", true)
+
+	importFiles, success := importReportPaths(importPath, report)
+	if !success {
+		return false
+	}
+	if len(importFiles) == 0 {
+		logger(5, "No "+strings.ToUpper(reportFileType(report))+" report files found in "+importPath, true)
+		return false
+	}
+	destinations := reportDestinations(report)
+	if len(destinations) == 0 {
+		logger(5, "No destinations to import the report files to", true)
+		return true
+	}
+	for _, importFile := range importFiles {
+		logger(3, "Importing "+importFile, true)
+		extractFolder, err := os.MkdirTemp("", "dataexport")
+		if err != nil {
+			logger(4, "Unable to create extract folder: "+err.Error(), true)
+			success = false
+			continue
+		}
+		if !processLocalFile(importFile, extractFolder, 0, report, destinations, false, nil) {
+			success = false
+		}
+		os.RemoveAll(extractFolder)
+	}
+	return success
+}
+
+// importReportPaths -- Returns the report files to import. A file path is imported as given, and for a
+// -- folder path the files of the report type (or compressed files holding them) are imported in name order
+func importReportPaths(importPath string, report reportStruct) ([]string, bool) {
+	info, err := os.Stat(importPath)
+	if err != nil {
+		logger(4, "Unable to read import path: "+err.Error(), true)
+		return nil, false
+	}
+	if !info.IsDir() {
+		return []string{importPath}, true
+	}
+	entries, err := os.ReadDir(importPath)
+	if err != nil {
+		logger(4, "Unable to read import folder: "+err.Error(), true)
+		return nil, false
+	}
+	importFiles := []string{}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		file := reportFileStruct{Name: entry.Name(), Type: strings.TrimPrefix(strings.ToLower(filepath.Ext(entry.Name())), ".")}
+		if reportFileWanted(report, file) {
+			importFiles = append(importFiles, filepath.Join(importPath, entry.Name()))
+		}
+	}
+	return importFiles, true
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestImportReportFilesCompressed(t *testing.T) {
+	importFolder := t.TempDir()
+	var content bytes.Buffer
+	gzipWriter := gzip.NewWriter(&content)
+	gzipWriter.Write([]byte("id\n1\n2\n"))
+	gzipWriter.Close()
+	if err := os.WriteFile(filepath.Join(importFolder, "x.csv.gz"), content.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	outputPath := filepath.Join(t.TempDir(), "{FileName}.jsonl")
+	report := reportStruct{
+		ReportName:   "Import",
+		Destinations: []destinationStruct{{Type: "jsonl", Path: outputPath}},
+		Table:        dbConfigStruct{Mapping: map[string]string{"id": "id"}},
+	}
+
+	//-- Importing the folder again must not find any files extracted by the first import
+	for i := 0; i < 2; i++ {
+		if !importReportFiles(importFolder, report) {
+			t.Fatalf("import %d: importReportFiles failed", i+1)
+		}
+		entries, err := os.ReadDir(importFolder)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 1 || entries[0].Name() != "x.csv.gz" {
+			t.Fatalf("import %d: import folder holds %d files, want only x.csv.gz", i+1, len(entries))
+		}
+		records, err := os.ReadFile(strings.Replace(outputPath, "{FileName}", "x", 1))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.Count(string(records), "\n"); got != 2 {
+			t.Errorf("import %d: %d records written, want 2", i+1, got)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// jsonLinesDefaultPath - Output path used when the destination does not specify one
+const jsonLinesDefaultPath = "reports/{ReportID}_{RunID}_{FileName}.jsonl"
+
+// jsonLinesSink - Writes the mapped report records as newline-delimited JSON, one object per record
+type jsonLinesSink struct {
+	destination destinationStruct
+	table       dbConfigStruct
+	file        *os.File
+	writer      *bufio.Writer
+	outputPath  string
+}
+
+func newJSONLinesSink(destination destinationStruct) sink {
+	return &jsonLinesSink{destination: destination}
+}
+
+// isStdoutPath -- Returns true if the destination path refers to stdout rather than a file
+func isStdoutPath(outputPath string) bool {
+	return outputPath == "-" || strings.ToLower(outputPath) == "stdout"
+}
+
+// Open - creates the output file, or prepares to write to stdout
+func (s *jsonLinesSink) Open(output outputContext) error {
+	s.table = output.Report.Table
+	if isStdoutPath(s.destination.Path) {
+		s.outputPath = "stdout"
+	} else {
+		outputPath := s.destination.Path
+		if outputPath == "" {
+			outputPath = jsonLinesDefaultPath
+		}
+		s.outputPath = expandPathTemplate(outputPath, output)
+		if err := os.MkdirAll(filepath.Dir(s.outputPath), 0777); err != nil {
+			return err
+		}
+		file, err := os.Create(s.outputPath)
+		if err != nil {
+			return err
+		}
+		s.file = file
+		s.writer = bufio.NewWriter(file)
+		logger(3, "Writing JSON Lines file "+s.outputPath, true)
+	}
+	return nil
+}
+
+// WriteBatch - writes each mapped record as a JSON object on its own line.
+// -- Records for stdout are written a batch at a time, so those of concurrent reports don't interleave
+func (s *jsonLinesSink) WriteBatch(rows []map[string]string, counters *counterStruct) error {
+	var lines bytes.Buffer
+	for _, reportRow := range rows {
+		jsonRecord, err := json.Marshal(mapRecord(reportRow, s.table))
+		if err != nil {
+			return err
+		}
+		lines.Write(jsonRecord)
+		lines.WriteByte('\n')
+	}
+	if s.writer == nil {
+		stdoutLock.Lock()
+		defer stdoutLock.Unlock()
+		_, err := stdoutFile.Write(lines.Bytes())
+		return err
+	}
+	_, err := s.writer.Write(lines.Bytes())
+	return err
+}
+
+// Commit - flushes any buffered records
+func (s *jsonLinesSink) Commit(counters *counterStruct) error {
+	if s.writer != nil {
+		if err := s.writer.Flush(); err != nil {
+			return err
+		}
+	}
+	logger(3, "JSON Lines written to "+s.outputPath, false)
+	return nil
+}
+
+// OutputFile - returns the path of the file written
+func (s *jsonLinesSink) OutputFile() string {
+	if s.file == nil {
+		return ""
+	}
+	return s.outputPath
+}
+
+// Close - closes the output file, stdout is left open for later reports
+func (s *jsonLinesSink) Close() error {
+	if s.file == nil {
+		return nil
+	}
+	return s.file.Close()
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// uniqueHeader -- Returns the header with blank column names replaced by their position ("Column 3"),
+// -- and repeated column names suffixed with their occurrence ("Status_2"), so that every column
+// -- can be told apart once records are keyed on the header. A warning lists any renamed columns
+func uniqueHeader(header []string) []string {
+	unique := make([]string, len(header))
+	used := make(map[string]bool, len(header))
+	for _, column := range header {
+		used[column] = true
+	}
+	seen := make(map[string]int, len(header))
+	renamed := []string{}
+	for i, column := range header {
+		seen[column]++
+		name := column
+		switch {
+		case strings.TrimSpace(column) == "":
+			name = "Column " + strconv.Itoa(i+1)
+		case seen[column] > 1:
+			name = column + "_" + strconv.Itoa(seen[column])
+		}
+		//-- Make sure a generated name doesn't clash with a column already in the header
+		baseName := name
+		for suffix := 2; name != column && used[name]; suffix++ {
+			name = baseName + "_" + strconv.Itoa(suffix)
+		}
+		if name != column {
+			used[name] = true
+			renamed = append(renamed, "["+column+"] at column "+strconv.Itoa(i+1)+" as ["+name+"]")
+		}
+		unique[i] = name
+	}
+	if len(renamed) > 0 {
+		logger(5, "Duplicate or blank header columns renamed: "+strings.Join(renamed, ", "), true)
+	}
+	return unique
+}
+
+// resolveMapping -- Returns the table definition with any mapping keys that reference a report column
+// -- by its position ("#3" for the third column) replaced with the name of the column in the header
+func resolveMapping(table dbConfigStruct, header []string) dbConfigStruct {
+	resolved := make(map[string]string, len(table.Mapping))
+	for repCol, dbCol := range table.Mapping {
+		if strings.HasPrefix(repCol, "#") {
+			position, err := strconv.Atoi(repCol[1:])
+			if err == nil && position >= 1 && position <= len(header) {
+				repCol = header[position-1]
+			} else {
+				logger(5, "Mapping column "+repCol+" does not match a column position in the report header", true)
+			}
+		}
+		resolved[repCol] = dbCol
+	}
+	table.Mapping = resolved
+	return table
+}
+
+// checkMapping -- Compares the report header with the table mapping, logging any mapped columns missing
+// -- from the report file with suggestions for close matches, and any report columns that are not mapped.
+// -- Returns false if any mapped columns are missing
+func checkMapping(table dbConfigStruct, header []string, fileName string) bool {
+	if len(table.Mapping) == 0 {
+		return true
+	}
+	inHeader := make(map[string]bool, len(header))
+	for _, column := range header {
+		inHeader[column] = true
+	}
+
+	missing := []string{}
+	for repCol := range table.Mapping {
+		if !inHeader[repCol] {
+			missing = append(missing, repCol)
+		}
+	}
+	sort.Strings(missing)
+	for _, repCol := range missing {
+		missingOutput := "Mapped column [" + repCol + "] not found in " + fileName
+		if suggestion := suggestColumn(repCol, header); suggestion != "" {
+			missingOutput += ", did you mean [" + suggestion + "]?"
+		}
+		logger(5, missingOutput, true)
+	}
+
+	unmapped := []string{}
+	for _, column := range header {
+		if _, ok := table.Mapping[column]; !ok {
+			unmapped = append(unmapped, "["+column+"]")
+		}
+	}
+	if len(unmapped) > 0 {
+		logger(3, "Report columns not mapped in "+fileName+": "+strings.Join(unmapped, ", "), configDebug)
+	}
+	return len(missing) == 0
+}
+
+// suggestColumn -- Returns the header column closest to the mapped column name, matching case
+// -- and whitespace insensitively first, then by edit distance. Returns an empty string if no column is close
+func suggestColumn(repCol string, header []string) string {
+	normalise := func(name string) string {
+		return strings.ToLower(strings.Join(strings.Fields(name), " "))
+	}
+	target := normalise(repCol)
+	suggestion := ""
+	bestDistance := len([]rune(target))/3 + 1
+	for _, column := range header {
+		candidate := normalise(column)
+		if candidate == target {
+			return column
+		}
+		if distance := editDistance(target, candidate); distance < bestDistance {
+			bestDistance = distance
+			suggestion = column
+		}
+	}
+	return suggestion
+}
+
+// editDistance -- Returns the Levenshtein distance between two strings
+func editDistance(a, b string) int {
+	runesA, runesB := []rune(a), []rune(b)
+	previous := make([]int, len(runesB)+1)
+	current := make([]int, len(runesB)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(runesA); i++ {
+		current[0] = i
+		for j := 1; j <= len(runesB); j++ {
+			cost := 1
+			if runesA[i-1] == runesB[j-1] {
+				cost = 0
+			}
+			current[j] = minInt(previous[j]+1, minInt(current[j-1]+1, previous[j-1]+cost))
+		}
+		previous, current = current, previous
+	}
+	return previous[len(runesB)]
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestUniqueHeader(t *testing.T) {
+	tests := []struct {
+		header []string
+		want   []string
+	}{
+		{[]string{"id", "name"}, []string{"id", "name"}},
+		{[]string{"id", "", "name"}, []string{"id", "Column 2", "name"}},
+		{[]string{"Status", "Status", "Status"}, []string{"Status", "Status_2", "Status_3"}},
+		{[]string{"Status", "Status", "Status_2"}, []string{"Status", "Status_2_2", "Status_2"}},
+		{[]string{"", "Column 1"}, []string{"Column 1_2", "Column 1"}},
+		{[]string{" ", "id"}, []string{"Column 1", "id"}},
+		{[]string{}, []string{}},
+	}
+	for _, tt := range tests {
+		if got := uniqueHeader(tt.header); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("uniqueHeader(%q) = %q, want %q", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestResolveMapping(t *testing.T) {
+	header := []string{"id", "Status", "Status_2"}
+	tests := []struct {
+		name    string
+		mapping map[string]string
+		want    map[string]string
+	}{
+		{"by name", map[string]string{"id": "h_id"}, map[string]string{"id": "h_id"}},
+		{"by position", map[string]string{"#1": "h_id", "#3": "h_prev_status"}, map[string]string{"id": "h_id", "Status_2": "h_prev_status"}},
+		{"position out of range", map[string]string{"#4": "h_other"}, map[string]string{"#4": "h_other"}},
+		{"invalid position", map[string]string{"#x": "h_other"}, map[string]string{"#x": "h_other"}},
+	}
+	for _, tt := range tests {
+		table := dbConfigStruct{TableName: "requests", Mapping: tt.mapping}
+		got := resolveMapping(table, header)
+		if !reflect.DeepEqual(got.Mapping, tt.want) {
+			t.Errorf("%s: Mapping = %v, want %v", tt.name, got.Mapping, tt.want)
+		}
+		if got.TableName != table.TableName {
+			t.Errorf("%s: TableName = %q, want %q", tt.name, got.TableName, table.TableName)
+		}
+	}
+}
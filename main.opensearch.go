@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// openSearchDefaultIndex - Index name template used when the destination does not specify one
+const openSearchDefaultIndex = "{ReportName}"
+
+// openSearchBulkResponse - The parts of the _bulk API response needed to count failed documents
+type openSearchBulkResponse struct {
+	Errors bool `json:"errors"`
+	Items  []map[string]struct {
+		Status int             `json:"status"`
+		Error  json.RawMessage `json:"error"`
+	} `json:"items"`
+}
+
+// openSearchSink - Indexes the mapped report records in Elasticsearch or OpenSearch using the _bulk API.
+// -- The value mapped to the table PrimaryKey is used as the document _id, so reruns update existing documents
+type openSearchSink struct {
+	destination destinationStruct
+	table       dbConfigStruct
+	client      *http.Client
+	label       string
+	bulkURL     string
+	index       string
+	primaryKey  string
+	body        bytes.Buffer
+	batchSize   int
+}
+
+func newOpenSearchSink(destination destinationStruct) sink {
+	return &openSearchSink{destination: destination}
+}
+
+// Open - resolves the index name for the report file
+func (s *openSearchSink) Open(output outputContext) error {
+	if s.destination.URL == "" {
+		return errors.New("no URL specified")
+	}
+	s.table = output.Report.Table
+	s.primaryKey = processColumnName(s.table.PrimaryKey)
+	s.client = newHTTPClient(time.Second * time.Duration(configTimeout))
+	s.bulkURL = strings.TrimRight(s.destination.URL, "/") + "/_bulk"
+
+	indexTemplate := s.destination.Index
+	if indexTemplate == "" {
+		indexTemplate = openSearchDefaultIndex
+	}
+	s.index = openSearchIndexName(expandPathTemplate(indexTemplate, output))
+	s.label = "Index " + s.index
+	logger(3, "Indexing records in "+s.index, true)
+	return nil
+}
+
+// WriteBatch - adds the mapped records to the bulk request, sending it each time the destination BatchSize is reached
+func (s *openSearchSink) WriteBatch(rows []map[string]string, counters *counterStruct) error {
+	for _, reportRow := range rows {
+		mappedRow := mapRecord(reportRow, s.table)
+		action := map[string]map[string]string{"index": {"_index": s.index}}
+		if s.primaryKey != "" && mappedRow[s.primaryKey] != "" {
+			action["index"]["_id"] = mappedRow[s.primaryKey]
+		}
+		jsonAction, err := json.Marshal(action)
+		if err != nil {
+			return err
+		}
+		jsonRecord, err := json.Marshal(mappedRow)
+		if err != nil {
+			return err
+		}
+		s.body.Write(jsonAction)
+		s.body.WriteByte('\n')
+		s.body.Write(jsonRecord)
+		s.body.WriteByte('\n')
+		s.batchSize++
+		if s.batchSize >= destinationBatchSize(s.destination) {
+			s.sendBatch(counters)
+		}
+	}
+	return nil
+}
+
+// Commit - sends any records remaining in the bulk request
+func (s *openSearchSink) Commit(counters *counterStruct) error {
+	if s.batchSize > 0 {
+		s.sendBatch(counters)
+	}
+	return nil
+}
+
+// Pending - returns the number of records in the bulk request not yet sent
+func (s *openSearchSink) Pending() int {
+	return s.batchSize
+}
+
+// Close - nothing to release, the HTTP client is discarded with the sink
+func (s *openSearchSink) Close() error {
+	return nil
+}
+
+// sendBatch - sends the bulk request and records the outcome in the batch statistics.
+// -- A batch is counted as failed if any of its documents could not be indexed
+func (s *openSearchSink) sendBatch(counters *counterStruct) {
+	batchCounters := counters.batch(s.label)
+	batchSize := s.batchSize
+	s.batchSize = 0
+	responseBody, err := sendWithRetry(s.client, s.destination, "POST", s.bulkURL, "application/x-ndjson", s.body.Bytes())
+	s.body.Reset()
+	if err != nil {
+		logger(4, s.label+" Bulk Request Failed: "+fmt.Sprintf("%v", err), false)
+		batchCounters.failed++
+		batchCounters.failedRecords += batchSize
+		return
+	}
+
+	var bulkResponse openSearchBulkResponse
+	if err := json.Unmarshal(responseBody, &bulkResponse); err != nil {
+		logger(4, s.label+" Unable to read bulk response: "+fmt.Sprintf("%v", err), false)
+		batchCounters.failed++
+		batchCounters.failedRecords += batchSize
+		return
+	}
+	failedDocuments := 0
+	if bulkResponse.Errors {
+		for _, item := range bulkResponse.Items {
+			for _, result := range item {
+				if result.Status > 299 {
+					failedDocuments++
+					logger(4, s.label+" Document Failed: "+string(result.Error), false)
+				}
+			}
+		}
+	}
+	if failedDocuments > 0 {
+		batchCounters.failed++
+	} else {
+		batchCounters.success++
+	}
+	batchCounters.failedRecords += failedDocuments
+	batchCounters.records += batchSize - failedDocuments
+}
+
+// openSearchIndexName -- Converts the expanded index template to a valid index name
+func openSearchIndexName(index string) string {
+	replacer := strings.NewReplacer(" ", "_", "\\", "_", "/", "_", "*", "_", "?", "_", "\"", "_", "<", "_", ">", "_", "|", "_", ",", "_", "#", "_", ":", "_")
+	return strings.TrimLeft(strings.ToLower(replacer.Replace(index)), "-_+")
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"errors"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	apiLib "github.com/hornbill/goApiLib"
+)
+
+// parameterDefaultDateFormat - Layout of the dates given by the parameter date tokens, when the report does not set one
+const parameterDefaultDateFormat = "2006-01-02"
+
+// parameterTokenRegex - Matches the date tokens in parameter values, with an optional day offset such as {today-7}
+var parameterTokenRegex = regexp.MustCompile(`\{(now|today|yesterday|tomorrow|startOfWeek|startOfMonth|endOfMonth|startOfLastMonth|endOfLastMonth|startOfYear)([+-]\d+)?\}`)
+
+// parameterFlags - The runtime parameters given by the repeatable -param name=value flag
+type parameterFlags map[string]string
+
+// String - returns the parameters in name=value form
+func (p parameterFlags) String() string {
+	params := []string{}
+	for _, name := range sortedParameterNames(p) {
+		params = append(params, name+"="+p[name])
+	}
+	return strings.Join(params, ",")
+}
+
+// Set - adds a name=value parameter from the command line
+func (p parameterFlags) Set(value string) error {
+	name, paramValue, found := strings.Cut(value, "=")
+	name = strings.TrimSpace(name)
+	if !found || name == "" {
+		return errors.New("parameters must be given as name=value")
+	}
+	p[name] = paramValue
+	return nil
+}
+
+// reportRunParameters -- Returns the runtime parameters to send with the report run, from the report
+// -- Parameters overridden by the -param flags, with the date tokens in their values expanded
+func reportRunParameters(report reportStruct, now time.Time) map[string]string {
+	params := make(map[string]string)
+	for name, value := range report.Parameters {
+		params[name] = value
+	}
+	for name, value := range configParams {
+		params[name] = value
+	}
+	dateFormat := report.ParameterDateFormat
+	if dateFormat == "" {
+		dateFormat = parameterDefaultDateFormat
+	}
+	for name, value := range params {
+		params[name] = expandParameterValue(value, now, dateFormat)
+	}
+	return params
+}
+
+// expandParameterValue -- Replaces the date tokens in a parameter value with the date they refer to,
+// -- relative to now and formatted with the dateFormat layout. A day offset can follow the token name,
+// -- so {today-7} is the date a week ago and {startOfMonth+14} is the 15th of the month
+func expandParameterValue(value string, now time.Time, dateFormat string) string {
+	return parameterTokenRegex.ReplaceAllStringFunc(value, func(token string) string {
+		match := parameterTokenRegex.FindStringSubmatch(token)
+		today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+		var date time.Time
+		switch match[1] {
+		case "now":
+			date = now
+		case "today":
+			date = today
+		case "yesterday":
+			date = today.AddDate(0, 0, -1)
+		case "tomorrow":
+			date = today.AddDate(0, 0, 1)
+		case "startOfWeek":
+			//-- Weeks start on a Monday
+			date = today.AddDate(0, 0, -((int(today.Weekday()) + 6) % 7))
+		case "startOfMonth":
+			date = today.AddDate(0, 0, 1-today.Day())
+		case "endOfMonth":
+			date = today.AddDate(0, 1, -today.Day())
+		case "startOfLastMonth":
+			date = today.AddDate(0, 0, 1-today.Day()).AddDate(0, -1, 0)
+		case "endOfLastMonth":
+			date = today.AddDate(0, 0, -today.Day())
+		case "startOfYear":
+			date = time.Date(today.Year(), time.January, 1, 0, 0, 0, 0, today.Location())
+		}
+		if match[2] != "" {
+			days, _ := strconv.Atoi(match[2])
+			date = date.AddDate(0, 0, days)
+		}
+		return date.Format(dateFormat)
+	})
+}
+
+// setRunParameters -- Adds the runtime parameters to the reportRun call, in name order
+func setRunParameters(espXmlmc *apiLib.XmlmcInstStruct, params map[string]string) {
+	for _, name := range sortedParameterNames(params) {
+		espXmlmc.OpenElement("parameters")
+		espXmlmc.SetParam("name", name)
+		espXmlmc.SetParam("value", params[name])
+		espXmlmc.CloseElement("parameters")
+	}
+}
+
+func sortedParameterNames(params map[string]string) []string {
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
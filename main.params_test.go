@@ -0,0 +1,94 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestExpandParameterValue(t *testing.T) {
+	//-- Thursday 5th March 2026
+	now := time.Date(2026, time.March, 5, 14, 30, 0, 0, time.UTC)
+	tests := []struct {
+		value      string
+		dateFormat string
+		want       string
+	}{
+		{"{today}", "2006-01-02", "2026-03-05"},
+		{"{yesterday}", "2006-01-02", "2026-03-04"},
+		{"{tomorrow}", "2006-01-02", "2026-03-06"},
+		{"{now}", "2006-01-02 15:04", "2026-03-05 14:30"},
+		{"{today}", "2006-01-02 15:04", "2026-03-05 00:00"},
+		{"{startOfWeek}", "2006-01-02", "2026-03-02"},
+		{"{startOfMonth}", "2006-01-02", "2026-03-01"},
+		{"{endOfMonth}", "2006-01-02", "2026-03-31"},
+		{"{startOfLastMonth}", "2006-01-02", "2026-02-01"},
+		{"{endOfLastMonth}", "2006-01-02", "2026-02-28"},
+		{"{startOfYear}", "2006-01-02", "2026-01-01"},
+		{"{today-7}", "2006-01-02", "2026-02-26"},
+		{"{startOfMonth+14}", "2006-01-02", "2026-03-15"},
+		{"{startOfLastMonth}..{endOfLastMonth}", "02/01/2006", "01/02/2026..28/02/2026"},
+		{"Service Desk", "2006-01-02", "Service Desk"},
+		{"{unknown}", "2006-01-02", "{unknown}"},
+	}
+	for _, tt := range tests {
+		if got := expandParameterValue(tt.value, now, tt.dateFormat); got != tt.want {
+			t.Errorf("expandParameterValue(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestExpandParameterValueStartOfWeek(t *testing.T) {
+	//-- Weeks start on a Monday, so a Sunday is the last day of the week
+	tests := []struct {
+		now  time.Time
+		want string
+	}{
+		{time.Date(2026, time.March, 2, 8, 0, 0, 0, time.UTC), "2026-03-02"},
+		{time.Date(2026, time.March, 8, 8, 0, 0, 0, time.UTC), "2026-03-02"},
+		{time.Date(2026, time.January, 1, 8, 0, 0, 0, time.UTC), "2025-12-29"},
+	}
+	for _, tt := range tests {
+		if got := expandParameterValue("{startOfWeek}", tt.now, "2006-01-02"); got != tt.want {
+			t.Errorf("expandParameterValue({startOfWeek}) on %s = %q, want %q", tt.now.Format("2006-01-02"), got, tt.want)
+		}
+	}
+}
+
+func TestParameterFlags(t *testing.T) {
+	tests := []struct {
+		value   string
+		wantErr bool
+		want    parameterFlags
+	}{
+		{"team=Service Desk", false, parameterFlags{"team": "Service Desk"}},
+		{"filter=a=b", false, parameterFlags{"filter": "a=b"}},
+		{"empty=", false, parameterFlags{"empty": ""}},
+		{"novalue", true, parameterFlags{}},
+		{"=value", true, parameterFlags{}},
+	}
+	for _, tt := range tests {
+		params := make(parameterFlags)
+		err := params.Set(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Set(%q) error = %v, want error %v", tt.value, err, tt.wantErr)
+		}
+		if !reflect.DeepEqual(params, tt.want) {
+			t.Errorf("Set(%q) = %v, want %v", tt.value, params, tt.want)
+		}
+	}
+}
+
+func TestReportRunParameters(t *testing.T) {
+	now := time.Date(2026, time.March, 5, 14, 30, 0, 0, time.UTC)
+	defer func() { configParams = make(parameterFlags) }()
+	configParams = parameterFlags{"team": "Change"}
+	report := reportStruct{
+		Parameters:          map[string]string{"from": "{yesterday}", "team": "Service Desk"},
+		ParameterDateFormat: "02/01/2006",
+	}
+	want := map[string]string{"from": "04/03/2026", "team": "Change"}
+	if got := reportRunParameters(report, now); !reflect.DeepEqual(got, want) {
+		t.Errorf("reportRunParameters = %v, want %v", got, want)
+	}
+}
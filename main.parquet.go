@@ -0,0 +1,166 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/xitongsys/parquet-go/writer"
+)
+
+// parquetDefaultPath - Output path used when the destination does not specify one
+const parquetDefaultPath = "reports/{ReportID}_{RunID}_{FileName}.parquet"
+
+// parquetTypes - Parquet schema definitions for the supported destination column Types
+var parquetTypes = map[string]string{
+	"string":  "type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY",
+	"int32":   "type=INT32",
+	"int64":   "type=INT64",
+	"float":   "type=FLOAT",
+	"double":  "type=DOUBLE",
+	"boolean": "type=BOOLEAN",
+}
+
+// parquetSink - Writes the mapped report records to a Parquet file
+type parquetSink struct {
+	destination destinationStruct
+	table       dbConfigStruct
+	columns     []string
+	columnTypes []string
+	file        *os.File
+	writer      *writer.CSVWriter
+	outputPath  string
+}
+
+func newParquetSink(destination destinationStruct) sink {
+	return &parquetSink{destination: destination}
+}
+
+// Open - creates the Parquet file and builds its schema from the report table mapping
+func (s *parquetSink) Open(output outputContext) error {
+	s.table = output.Report.Table
+	s.columns = mappedColumns(s.table)
+	if len(s.columns) == 0 {
+		return errors.New("no columns mapped in the report table definition")
+	}
+
+	schema := []string{}
+	for _, column := range s.columns {
+		columnType := strings.ToLower(s.destination.Types[column])
+		if columnType == "" {
+			columnType = "string"
+		}
+		typeDefinition, ok := parquetTypes[columnType]
+		if !ok {
+			return errors.New("unsupported Parquet type " + columnType + " for column " + column)
+		}
+		s.columnTypes = append(s.columnTypes, columnType)
+		schema = append(schema, "name="+column+", "+typeDefinition+", repetitiontype=OPTIONAL")
+	}
+
+	outputPath := s.destination.Path
+	if outputPath == "" {
+		outputPath = parquetDefaultPath
+	}
+	s.outputPath = expandPathTemplate(outputPath, output)
+	if err := os.MkdirAll(filepath.Dir(s.outputPath), 0777); err != nil {
+		return err
+	}
+	file, err := os.Create(s.outputPath)
+	if err != nil {
+		return err
+	}
+	s.file = file
+
+	s.writer, err = writer.NewCSVWriterFromWriter(schema, s.file, 4)
+	if err != nil {
+		return err
+	}
+	logger(3, "Writing Parquet file "+s.outputPath, true)
+	return nil
+}
+
+// WriteBatch - converts the mapped values to the column types and writes them to the file
+// -- Values that are empty or cannot be converted to the column type are written as null
+func (s *parquetSink) WriteBatch(rows []map[string]string, counters *counterStruct) error {
+	for _, reportRow := range rows {
+		mappedRow := mapRecord(reportRow, s.table)
+		record := make([]*string, len(s.columns))
+		for i, column := range s.columns {
+			if mappedRow[column] == "" {
+				continue
+			}
+			value, ok := parquetValue(mappedRow[column], s.columnTypes[i])
+			if ok {
+				record[i] = &value
+			}
+		}
+		if err := s.writer.WriteString(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Commit - writes the Parquet footer
+func (s *parquetSink) Commit(counters *counterStruct) error {
+	if err := s.writer.WriteStop(); err != nil {
+		return err
+	}
+	logger(3, "Parquet file written to "+s.outputPath, false)
+	return nil
+}
+
+// OutputFile - returns the path of the file written
+func (s *parquetSink) OutputFile() string {
+	if s.file == nil {
+		return ""
+	}
+	return s.outputPath
+}
+
+// Close - closes the Parquet file
+func (s *parquetSink) Close() error {
+	if s.file == nil {
+		return nil
+	}
+	return s.file.Close()
+}
+
+// parquetValue -- Converts the report value to the canonical string form of the Parquet column type
+// -- Returns false if the value cannot be converted
+func parquetValue(value, columnType string) (string, bool) {
+	var err error
+	converted := value
+	switch columnType {
+	case "int32":
+		var intValue int64
+		intValue, err = strconv.ParseInt(strings.TrimSpace(value), 10, 32)
+		converted = strconv.FormatInt(intValue, 10)
+	case "int64":
+		var intValue int64
+		intValue, err = strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+		converted = strconv.FormatInt(intValue, 10)
+	case "float":
+		var floatValue float64
+		floatValue, err = strconv.ParseFloat(strings.TrimSpace(value), 32)
+		converted = strconv.FormatFloat(floatValue, 'g', -1, 32)
+	case "double":
+		var floatValue float64
+		floatValue, err = strconv.ParseFloat(strings.TrimSpace(value), 64)
+		converted = strconv.FormatFloat(floatValue, 'g', -1, 64)
+	case "boolean":
+		var boolValue bool
+		boolValue, err = strconv.ParseBool(strings.TrimSpace(value))
+		converted = strconv.FormatBool(boolValue)
+	}
+	if err != nil {
+		if configDebug {
+			logger(1, "Unable to convert value ["+value+"] to "+columnType+", writing null", false)
+		}
+		return "", false
+	}
+	return converted, true
+}
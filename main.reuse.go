@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"time"
+
+	apiLib "github.com/hornbill/goApiLib"
+)
+
+// reportRunDateFormat - Layout of the date and time values returned by the instance, in UTC
+const reportRunDateFormat = "2006-01-02 15:04:05"
+
+// latestReportRun -- Returns the ID of the most recent completed run of the report on the instance that completed
+// -- within the MaxRunAge seconds of the report (default one day), so its files can be retrieved rather than
+// -- running the report again. Runs are not reused when the report has runtime parameters, as the parameters
+// -- of existing runs are not known. Returns 0 if no run is recent enough
+func latestReportRun(report reportStruct, espXmlmc *apiLib.XmlmcInstStruct) int {
+	if len(reportRunParameters(report, time.Now())) > 0 {
+		logger(5, "ReuseLatestRun is ignored when runtime parameters are set, running the report", true)
+		return 0
+	}
+	maxRunAge := time.Second * time.Duration(defaultMaxRunAge)
+	if report.MaxRunAge > 0 {
+		maxRunAge = time.Second * time.Duration(report.MaxRunAge)
+	}
+
+	espXmlmc.SetParam("reportId", strconv.Itoa(report.ReportID))
+	XMLMC, xmlmcErr := espXmlmc.Invoke("reporting", "reportRunList")
+	if xmlmcErr != nil {
+		logger(4, "Unable to list report runs: "+xmlmcErr.Error(), true)
+		return 0
+	}
+	var xmlRespon xmlmcReportRunListResponse
+	err := xml.Unmarshal([]byte(XMLMC), &xmlRespon)
+	if err != nil {
+		logger(4, "Unable to list report runs: "+fmt.Sprintf("%v", err), true)
+		return 0
+	}
+	if xmlRespon.MethodResult != "ok" {
+		logger(4, "Unable to list report runs: "+xmlRespon.State.ErrorRet, true)
+		return 0
+	}
+
+	latestRunID := 0
+	var latestCompleted time.Time
+	for _, reportRun := range xmlRespon.ReportRuns {
+		if reportRun.Status != "completed" {
+			continue
+		}
+		completed, err := time.Parse(reportRunDateFormat, reportRun.CompletedOn)
+		if err != nil || time.Since(completed) > maxRunAge {
+			continue
+		}
+		if latestRunID == 0 || completed.After(latestCompleted) {
+			latestRunID = reportRun.RunID
+			latestCompleted = completed
+		}
+	}
+	if latestRunID == 0 {
+		logger(3, "No completed run found within "+maxRunAge.String()+", running the report", true)
+		return 0
+	}
+	logger(3, "Reusing Report Run ID ["+strconv.Itoa(latestRunID)+"], completed "+latestCompleted.Format(reportRunDateFormat)+" UTC", true)
+	return latestRunID
+}
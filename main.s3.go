@@ -0,0 +1,185 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// s3DefaultPath - Object key template used when the destination does not specify one
+const s3DefaultPath = "{ReportName}/{Date}/{Name}"
+
+// s3Sink - Uploads report files to an S3 compatible object storage bucket
+type s3Sink struct {
+	destination destinationStruct
+}
+
+func newS3Sink(destination destinationStruct) fileSink {
+	return &s3Sink{destination: destination}
+}
+
+// DeliverFile - uploads the local file to the bucket, using the destination Path as the object key template.
+// -- The {Name} token is replaced with the name of the local file being uploaded
+func (s *s3Sink) DeliverFile(localPath string, output outputContext) error {
+	if s.destination.Bucket == "" {
+		return errors.New("no bucket specified")
+	}
+	accessKey := s.destination.AccessKey
+	secretKey := s.destination.SecretKey
+	if accessKey == "" {
+		accessKey = os.Getenv("AWS_ACCESS_KEY_ID")
+		secretKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+	}
+	if accessKey == "" || secretKey == "" {
+		return errors.New("no credentials specified")
+	}
+	region := s.destination.Region
+	if region == "" {
+		region = "us-east-1"
+	}
+
+	keyTemplate := s.destination.Path
+	if keyTemplate == "" {
+		keyTemplate = s3DefaultPath
+	}
+	keyTemplate = strings.ReplaceAll(keyTemplate, "{Name}", filepath.Base(localPath))
+	objectKey := strings.TrimLeft(expandPathTemplate(keyTemplate, output), "/")
+
+	objectURL, err := s.objectURL(region, objectKey)
+	if err != nil {
+		return err
+	}
+	logger(3, "Uploading "+filepath.Base(localPath)+" to bucket "+s.destination.Bucket+" as "+objectKey+"...", true)
+
+	file, err := os.Open(localPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	//-- Hash the payload for the request signature, then rewind for the upload
+	hash := sha256.New()
+	size, err := io.Copy(hash, file)
+	if err != nil {
+		return err
+	}
+	payloadHash := hex.EncodeToString(hash.Sum(nil))
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("PUT", objectURL, file)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	req.Header.Set("User-Agent", "Go-http-client/1.1")
+	req.Header.Set("x-amz-content-sha256", payloadHash)
+	req.Header.Set("x-amz-date", time.Now().UTC().Format("20060102T150405Z"))
+	signS3Request(req, payloadHash, accessKey, secretKey, region)
+
+	resp, err := newHTTPClient(0).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("invalid HTTP response: %d %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	logger(3, "Uploaded "+filepath.Base(localPath)+" to "+objectURL, false)
+	return nil
+}
+
+// objectURL - builds the URL of the object, addressing the bucket by path or by host name
+func (s *s3Sink) objectURL(region, objectKey string) (string, error) {
+	endpoint := s.destination.Endpoint
+	if endpoint == "" {
+		endpoint = "https://s3." + region + ".amazonaws.com"
+	}
+	if !strings.Contains(endpoint, "://") {
+		endpoint = "https://" + endpoint
+	}
+	endpointURL, err := url.Parse(strings.TrimRight(endpoint, "/"))
+	if err != nil {
+		return "", err
+	}
+	if s.destination.UsePathStyle {
+		return endpointURL.Scheme + "://" + endpointURL.Host + "/" + s3EscapePath(s.destination.Bucket+"/"+objectKey), nil
+	}
+	return endpointURL.Scheme + "://" + s.destination.Bucket + "." + endpointURL.Host + "/" + s3EscapePath(objectKey), nil
+}
+
+// signS3Request -- Adds an AWS Signature Version 4 Authorization header to the request.
+// -- The host header, and any Date or x-amz- headers already set on the request, are signed
+func signS3Request(req *http.Request, payloadHash, accessKey, secretKey, region string) {
+	amzDate := req.Header.Get("x-amz-date")
+	scope := amzDate[:8] + "/" + region + "/s3/aws4_request"
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name := range req.Header {
+		lowerName := strings.ToLower(name)
+		if lowerName == "date" || strings.HasPrefix(lowerName, "x-amz-") {
+			headers[lowerName] = strings.TrimSpace(req.Header.Get(name))
+		}
+	}
+	headerNames := []string{}
+	for name := range headers {
+		headerNames = append(headerNames, name)
+	}
+	sort.Strings(headerNames)
+	canonicalHeaders := ""
+	for _, name := range headerNames {
+		canonicalHeaders += name + ":" + headers[name] + "\n"
+	}
+	signedHeaders := strings.Join(headerNames, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	canonicalHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(canonicalHash[:])
+
+	signingKey := s3HMAC([]byte("AWS4"+secretKey), amzDate[:8])
+	signingKey = s3HMAC(signingKey, region)
+	signingKey = s3HMAC(signingKey, "s3")
+	signingKey = s3HMAC(signingKey, "aws4_request")
+	signature := hex.EncodeToString(s3HMAC(signingKey, stringToSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+accessKey+"/"+scope+", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+func s3HMAC(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// s3EscapePath -- URI encodes each segment of the object path as required by the S3 signature
+func s3EscapePath(objectPath string) string {
+	var escaped strings.Builder
+	for _, b := range []byte(objectPath) {
+		if (b >= 'A' && b <= 'Z') || (b >= 'a' && b <= 'z') || (b >= '0' && b <= '9') ||
+			b == '-' || b == '_' || b == '.' || b == '~' || b == '/' {
+			escaped.WriteByte(b)
+		} else {
+			escaped.WriteString(fmt.Sprintf("%%%02X", b))
+		}
+	}
+	return escaped.String()
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// sinkBatchSize - The number of report records passed to the destinations in each write
+const sinkBatchSize = 100
+
+// sink - A destination that report records are delivered to.
+// -- Open is called once per report file, followed by any number of WriteBatch calls,
+// -- then Commit once all records have been written. Close is always called, and must
+// -- release any resources held by the sink whether or not Commit was reached.
+type sink interface {
+	Open(output outputContext) error
+	WriteBatch(rows []map[string]string, counters *counterStruct) error
+	Commit(counters *counterStruct) error
+	Close() error
+}
+
+// fileSink - A destination that report files are delivered to, rather than report records.
+// -- DeliverFile is called with the downloaded report file, and again with each file written
+// -- by the other destinations when the destination has UploadTransformed set
+type fileSink interface {
+	DeliverFile(localPath string, output outputContext) error
+}
+
+// resumableSink - Implemented by sinks that deliver records outside of the tool, so the records they delivered
+// -- before a run was interrupted are skipped when it is resumed. Pending returns the records held but not yet delivered
+type resumableSink interface {
+	Pending() int
+}
+
+// outputFiler - Implemented by sinks that write their records to a local file
+type outputFiler interface {
+	OutputFile() string
+}
+
+// sinkTypes - Constructors for the supported destination types, keyed on the lower case Type
+var sinkTypes = map[string]func(destination destinationStruct) sink{
+	"database":      newDatabaseSink,
+	"parquet":       newParquetSink,
+	"jsonl":         newJSONLinesSink,
+	"http":          newHTTPSink,
+	"opensearch":    newOpenSearchSink,
+	"elasticsearch": newOpenSearchSink,
+	"workbook":      newWorkbookSink,
+}
+
+// fileSinkTypes - Constructors for the destination types that report files are delivered to
+var fileSinkTypes = map[string]func(destination destinationStruct) fileSink{
+	"s3": newS3Sink,
+}
+
+// isFileDestination -- Returns true if the destination receives report files rather than records
+func isFileDestination(destination destinationStruct) bool {
+	_, ok := fileSinkTypes[strings.ToLower(destination.Type)]
+	return ok
+}
+
+// splitDestinations -- Splits the destinations in to those receiving report files and those receiving records
+func splitDestinations(destinations []destinationStruct) ([]destinationStruct, []destinationStruct) {
+	fileDestinations := []destinationStruct{}
+	recordDestinations := []destinationStruct{}
+	for _, destination := range destinations {
+		if isFileDestination(destination) {
+			fileDestinations = append(fileDestinations, destination)
+		} else {
+			recordDestinations = append(recordDestinations, destination)
+		}
+	}
+	return fileDestinations, recordDestinations
+}
+
+// reportDestinations -- Returns the destinations records from the report should be delivered to
+// -- Reports without any destinations configured are written to the database
+func reportDestinations(report reportStruct) []destinationStruct {
+	destinations := report.Destinations
+	if len(destinations) == 0 {
+		destinations = []destinationStruct{{Type: "database"}}
+	}
+	if !configSkipInsert {
+		return destinations
+	}
+	//-- skipdb flag set, so leave out any database destinations
+	filtered := []destinationStruct{}
+	for _, destination := range destinations {
+		if strings.ToLower(destination.Type) != "database" {
+			filtered = append(filtered, destination)
+		}
+	}
+	return filtered
+}
+
+// databaseRequired -- Returns true if any report is configured to write to the database
+func databaseRequired() bool {
+	for _, report := range apiCallConfig.Reports {
+		for _, destination := range reportDestinations(report) {
+			if strings.ToLower(destination.Type) == "database" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// stdoutRequired -- Returns true if any report destination writes records to stdout
+func stdoutRequired() bool {
+	for _, report := range apiCallConfig.Reports {
+		for _, destination := range reportDestinations(report) {
+			if strings.ToLower(destination.Type) == "jsonl" && isStdoutPath(destination.Path) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// openSinks -- Creates and opens a sink for each destination
+// -- Returns false if any sink could not be opened, along with the sinks that were
+func openSinks(destinations []destinationStruct, output outputContext) ([]sink, bool) {
+	sinks := []sink{}
+	for _, destination := range destinations {
+		newSink, ok := sinkTypes[strings.ToLower(destination.Type)]
+		if !ok {
+			logger(4, "Unknown destination type: "+destination.Type, true)
+			return sinks, false
+		}
+		s := newSink(destination)
+		if err := s.Open(output); err != nil {
+			logger(4, "Error opening "+destination.Type+" destination: "+fmt.Sprintf("%v", err), true)
+			return sinks, false
+		}
+		sinks = append(sinks, s)
+	}
+	return sinks, true
+}
+
+// writeSinks -- Writes a batch of records to each sink, returns false if any sink failed
+func writeSinks(sinks []sink, rows []map[string]string, counters *counterStruct) bool {
+	for _, s := range sinks {
+		if err := s.WriteBatch(rows, counters); err != nil {
+			logger(4, "Error writing records to destination: "+fmt.Sprintf("%v", err), true)
+			return false
+		}
+	}
+	return true
+}
+
+// commitSinks -- Commits each sink, returns false if any sink failed
+func commitSinks(sinks []sink, counters *counterStruct) bool {
+	success := true
+	for _, s := range sinks {
+		if err := s.Commit(counters); err != nil {
+			logger(4, "Error committing records to destination: "+fmt.Sprintf("%v", err), true)
+			success = false
+		}
+	}
+	return success
+}
+
+// sinkOutputFiles -- Returns the local files written by the sinks
+func sinkOutputFiles(sinks []sink) []string {
+	outputFiles := []string{}
+	for _, s := range sinks {
+		if filer, ok := s.(outputFiler); ok && filer.OutputFile() != "" {
+			outputFiles = append(outputFiles, filer.OutputFile())
+		}
+	}
+	return outputFiles
+}
+
+// deliverFiles -- Delivers each local file to the file destinations
+// -- When transformed is set, only destinations with UploadTransformed set receive the files
+func deliverFiles(destinations []destinationStruct, localFiles []string, output outputContext, transformed bool) bool {
+	success := true
+	for _, destination := range destinations {
+		if transformed && !destination.UploadTransformed {
+			continue
+		}
+		fs := fileSinkTypes[strings.ToLower(destination.Type)](destination)
+		for _, localFile := range localFiles {
+			if err := fs.DeliverFile(localFile, output); err != nil {
+				logger(4, "Error delivering "+filepath.Base(localFile)+" to "+destination.Type+" destination: "+fmt.Sprintf("%v", err), true)
+				success = false
+			}
+		}
+	}
+	return success
+}
+
+// closeSinks -- Closes each sink, logging rather than returning any errors
+func closeSinks(sinks []sink) {
+	for _, s := range sinks {
+		if err := s.Close(); err != nil {
+			logger(4, "Error closing destination: "+fmt.Sprintf("%v", err), false)
+		}
+	}
+}
+
+// expandPathTemplate -- Replaces the {ReportID}, {ReportName}, {RunID}, {Date}, {Time} and {FileName}
+// -- tokens in a destination path with the details of the report file being delivered
+func expandPathTemplate(template string, output outputContext) string {
+	fileName := strings.TrimSuffix(output.FileName, path.Ext(output.FileName))
+	replacer := strings.NewReplacer(
+		"{ReportID}", strconv.Itoa(output.Report.ReportID),
+		"{ReportName}", output.Report.ReportName,
+		"{RunID}", strconv.Itoa(output.RunID),
+		"{Date}", output.RunDate.Format("20060102"),
+		"{Time}", output.RunDate.Format("150405"),
+		"{FileName}", fileName,
+	)
+	return replacer.Replace(template)
+}
+
+// mappedColumns -- Returns the sorted column names that report records are mapped to
+func mappedColumns(table dbConfigStruct) []string {
+	columns := []string{}
+	for _, dbCol := range table.Mapping {
+		columns = append(columns, processColumnName(dbCol))
+	}
+	sort.Strings(columns)
+	return columns
+}
+
+// mapRecord -- Returns the report record keyed on the mapped column names rather than the report columns
+func mapRecord(reportRow map[string]string, table dbConfigStruct) map[string]string {
+	mappedRow := make(map[string]string, len(table.Mapping))
+	for repCol, dbCol := range table.Mapping {
+		mappedRow[processColumnName(dbCol)] = reportRow[repCol]
+	}
+	return mappedRow
+}
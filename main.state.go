@@ -0,0 +1,260 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Report run state statuses
+const (
+	stateStatusRunning    = "running"
+	stateStatusProcessing = "processing"
+)
+
+// runStateStruct - The state of the report runs in progress, saved to the state file so an
+// -- interrupted run can be resumed by the next invocation of the tool
+type runStateStruct struct {
+	Reports map[string]*reportStateStruct
+}
+
+// reportStateStruct - The state of a report run. Attempts counts the invocations that have resumed the run,
+// -- Downloads holds the local path of each retrieved report file, RowsLoaded the records passed to the
+// -- destinations from each processed file, and CompletedFiles the report files that have been fully processed
+type reportStateStruct struct {
+	key            string
+	RunID          int
+	Reused         bool
+	Status         string
+	Attempts       int
+	Updated        time.Time
+	Downloads      map[string]string
+	RowsLoaded     map[string]int
+	CompletedFiles map[string]bool
+}
+
+var (
+	runState     = runStateStruct{Reports: make(map[string]*reportStateStruct)}
+	runStateLock sync.Mutex
+)
+
+// loadRunState -- Loads the state file, when one is configured. A missing state file is treated as empty
+func loadRunState() bool {
+	if configStateFile == "" {
+		return true
+	}
+	stateJSON, err := os.ReadFile(configStateFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return true
+	}
+	if err == nil {
+		err = json.Unmarshal(stateJSON, &runState)
+	}
+	if err != nil {
+		logger(4, "Error loading state file "+configStateFile+": "+err.Error(), true)
+		return false
+	}
+	if runState.Reports == nil {
+		runState.Reports = make(map[string]*reportStateStruct)
+	}
+
+	//-- Runs saved too long ago are discarded rather than resumed, as they may no longer be on the instance
+	maxAge := time.Second * time.Duration(defaultStateMaxAge)
+	if apiCallConfig.StateMaxAge > 0 {
+		maxAge = time.Second * time.Duration(apiCallConfig.StateMaxAge)
+	}
+	runStateLock.Lock()
+	defer runStateLock.Unlock()
+	expired := false
+	for key, state := range runState.Reports {
+		if time.Since(state.Updated) > maxAge {
+			logger(5, "Discarding the state of "+key+" Run ID ["+strconv.Itoa(state.RunID)+"], last updated "+state.Updated.Format(time.RFC3339), true)
+			delete(runState.Reports, key)
+			expired = true
+		}
+	}
+	if expired {
+		saveRunState()
+	}
+	return true
+}
+
+// saveRunState -- Writes the state file through a temporary file, so an interrupted write can't corrupt it.
+// -- The caller must hold runStateLock
+func saveRunState() {
+	stateJSON, err := json.MarshalIndent(runState, "", "    ")
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(configStateFile), 0777)
+	}
+	if err == nil {
+		err = os.WriteFile(configStateFile+".tmp", stateJSON, 0644)
+	}
+	if err == nil {
+		err = os.Rename(configStateFile+".tmp", configStateFile)
+	}
+	if err != nil {
+		logger(4, "Error saving state file "+configStateFile+": "+err.Error(), false)
+	}
+}
+
+// reportState -- Returns the saved state of the report, or a new state if the report has none.
+// -- Returns nil when no state file is configured, and the state methods do nothing on a nil state
+func reportState(report reportStruct) *reportStateStruct {
+	if configStateFile == "" {
+		return nil
+	}
+	key := report.ReportName + " [" + strconv.Itoa(report.ReportID) + "]"
+	runStateLock.Lock()
+	defer runStateLock.Unlock()
+	state, ok := runState.Reports[key]
+	if !ok {
+		state = &reportStateStruct{}
+	}
+	state.key = key
+	if state.Downloads == nil {
+		state.Downloads = make(map[string]string)
+	}
+	if state.RowsLoaded == nil {
+		state.RowsLoaded = make(map[string]int)
+	}
+	if state.CompletedFiles == nil {
+		state.CompletedFiles = make(map[string]bool)
+	}
+	return state
+}
+
+// update - applies the change to the report state, then saves the state file
+func (s *reportStateStruct) update(change func()) {
+	if s == nil {
+		return
+	}
+	runStateLock.Lock()
+	defer runStateLock.Unlock()
+	change()
+	s.Updated = time.Now()
+	runState.Reports[s.key] = s
+	saveRunState()
+}
+
+// clear - removes the report from the state file, once its run has been processed or has failed
+func (s *reportStateStruct) clear() {
+	if s == nil {
+		return
+	}
+	runStateLock.Lock()
+	defer runStateLock.Unlock()
+	if _, ok := runState.Reports[s.key]; ok {
+		delete(runState.Reports, s.key)
+		saveRunState()
+	}
+}
+
+// resumeRunID - returns the ID of a run started by an earlier invocation of the tool, or 0 if there is none
+func (s *reportStateStruct) resumeRunID() int {
+	if s == nil || s.Status == "" {
+		return 0
+	}
+	return s.RunID
+}
+
+// resumeAttempt - counts an invocation resuming the run. Returns false once the run has been resumed
+// -- StateMaxAttempts times (default 3) without completing, so a run that can't be processed is given up
+func (s *reportStateStruct) resumeAttempt() bool {
+	if s == nil {
+		return false
+	}
+	maxAttempts := defaultStateMaxAttempts
+	if apiCallConfig.StateMaxAttempts > 0 {
+		maxAttempts = apiCallConfig.StateMaxAttempts
+	}
+	if s.Attempts >= maxAttempts {
+		return false
+	}
+	s.update(func() {
+		s.Attempts++
+	})
+	return true
+}
+
+// setRun - records the run being waited on, and whether it was reused rather than started by the tool
+func (s *reportStateStruct) setRun(runID int, reused bool) {
+	s.update(func() {
+		s.RunID = runID
+		s.Reused = reused
+		s.Status = stateStatusRunning
+		s.Attempts = 0
+		s.Downloads = make(map[string]string)
+		s.RowsLoaded = make(map[string]int)
+		s.CompletedFiles = make(map[string]bool)
+	})
+}
+
+// setProcessing - records that the run has completed and its files are being processed
+func (s *reportStateStruct) setProcessing() {
+	s.update(func() {
+		s.Status = stateStatusProcessing
+	})
+}
+
+// downloadedFile - returns the local path of a report file retrieved by an earlier invocation,
+// -- or an empty string if it has not been retrieved or is no longer on disk
+func (s *reportStateStruct) downloadedFile(fileName string) string {
+	if s == nil {
+		return ""
+	}
+	runStateLock.Lock()
+	localPath := s.Downloads[fileName]
+	runStateLock.Unlock()
+	if localPath == "" {
+		return ""
+	}
+	if _, err := os.Stat(localPath); err != nil {
+		return ""
+	}
+	return localPath
+}
+
+// setDownloaded - records the local path of a retrieved report file
+func (s *reportStateStruct) setDownloaded(fileName, localPath string) {
+	s.update(func() {
+		s.Downloads[fileName] = localPath
+	})
+}
+
+// fileCompleted - returns true if the report file was fully processed by an earlier invocation
+func (s *reportStateStruct) fileCompleted(fileName string) bool {
+	if s == nil {
+		return false
+	}
+	runStateLock.Lock()
+	defer runStateLock.Unlock()
+	return s.CompletedFiles[fileName]
+}
+
+// setFileCompleted - records that the report file has been fully processed
+func (s *reportStateStruct) setFileCompleted(fileName string) {
+	s.update(func() {
+		s.CompletedFiles[fileName] = true
+	})
+}
+
+// rowsLoaded - returns the number of records passed to the destinations from the file by an earlier invocation
+func (s *reportStateStruct) rowsLoaded(fileName string) int {
+	if s == nil {
+		return 0
+	}
+	runStateLock.Lock()
+	defer runStateLock.Unlock()
+	return s.RowsLoaded[fileName]
+}
+
+// setRowsLoaded - records the number of records passed to the destinations from the file
+func (s *reportStateStruct) setRowsLoaded(fileName string, rows int) {
+	s.update(func() {
+		s.RowsLoaded[fileName] = rows
+	})
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// useTestStateFile -- Points the tool at a state file in a temporary folder, restoring the run state once the test ends
+func useTestStateFile(t *testing.T) string {
+	t.Helper()
+	configStateFile = filepath.Join(t.TempDir(), "state.json")
+	runState = runStateStruct{Reports: make(map[string]*reportStateStruct)}
+	t.Cleanup(func() {
+		configStateFile = ""
+		runState = runStateStruct{Reports: make(map[string]*reportStateStruct)}
+		apiCallConfig = apiCallStruct{}
+	})
+	return configStateFile
+}
+
+func TestLoadRunStateDiscardsExpired(t *testing.T) {
+	tests := []struct {
+		name        string
+		maxAge      int
+		wantReports []string
+	}{
+		{"default max age", 0, []string{"Recent [1]"}},
+		{"longer max age", 3 * 86400, []string{"Recent [1]", "Old [2]"}},
+		{"shorter max age", 60, []string{}},
+	}
+	for _, tt := range tests {
+		stateFile := useTestStateFile(t)
+		apiCallConfig.StateMaxAge = tt.maxAge
+		saved := runStateStruct{Reports: map[string]*reportStateStruct{
+			"Recent [1]": {RunID: 10, Status: stateStatusRunning, Updated: time.Now().Add(-time.Hour)},
+			"Old [2]":    {RunID: 20, Status: stateStatusProcessing, Updated: time.Now().Add(-2 * 24 * time.Hour)},
+		}}
+		stateJSON, _ := json.Marshal(saved)
+		if err := os.WriteFile(stateFile, stateJSON, 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		if !loadRunState() {
+			t.Fatalf("%s: loadRunState failed", tt.name)
+		}
+		if len(runState.Reports) != len(tt.wantReports) {
+			t.Errorf("%s: %d reports loaded, want %d", tt.name, len(runState.Reports), len(tt.wantReports))
+		}
+		for _, key := range tt.wantReports {
+			if runState.Reports[key] == nil {
+				t.Errorf("%s: state of %s discarded", tt.name, key)
+			}
+		}
+		stateJSON, _ = os.ReadFile(stateFile)
+		var rewritten runStateStruct
+		json.Unmarshal(stateJSON, &rewritten)
+		if len(rewritten.Reports) != len(tt.wantReports) {
+			t.Errorf("%s: %d reports in the state file, want %d", tt.name, len(rewritten.Reports), len(tt.wantReports))
+		}
+	}
+}
+
+func TestResumeAttempt(t *testing.T) {
+	useTestStateFile(t)
+	apiCallConfig.StateMaxAttempts = 2
+	report := reportStruct{ReportID: 1, ReportName: "Resume"}
+	reportState(report).setRun(10, false)
+
+	for attempt := 1; attempt <= 3; attempt++ {
+		//-- Each invocation loads the state saved by the last
+		runState = runStateStruct{}
+		if !loadRunState() {
+			t.Fatal("loadRunState failed")
+		}
+		state := reportState(report)
+		if state.resumeRunID() != 10 {
+			t.Fatalf("attempt %d: resumeRunID = %d, want 10", attempt, state.resumeRunID())
+		}
+		if got, want := state.resumeAttempt(), attempt <= 2; got != want {
+			t.Errorf("attempt %d: resumeAttempt = %v, want %v", attempt, got, want)
+		}
+	}
+
+	state := reportState(report)
+	state.setRun(11, false)
+	if state.Attempts != 0 || !state.resumeAttempt() {
+		t.Errorf("attempts not reset for a new run, Attempts = %d", state.Attempts)
+	}
+	state.clear()
+	if reportState(report).resumeRunID() != 0 {
+		t.Error("cleared run still resumed")
+	}
+	var nilState *reportStateStruct
+	if nilState.resumeAttempt() {
+		t.Error("resumeAttempt = true without a state file")
+	}
+}
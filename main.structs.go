@@ -1,40 +1,75 @@
 package main
 
 import (
-	apiLib "github.com/hornbill/goApiLib"
+	"os"
+	"time"
+
 	"github.com/jmoiron/sqlx"
 )
 
 const (
-	version  = "1.9.1"
+	version  = "1.10.0"
 	toolName = "Hornbill Data Export Tool"
+
+	//Process exit codes when one or more reports fail, or no reports could be run
+	exitCodePartialFailure = 3
+	exitCodeTotalFailure   = 4
+
+	//Report run polling defaults, in seconds
+	defaultPollInterval    = 3
+	defaultMaxPollInterval = 60
+	defaultMaxRunAge       = 86400
+
+	//Saved report run state defaults, in seconds and invocations of the tool
+	defaultStateMaxAge      = 86400
+	defaultStateMaxAttempts = 3
 )
 
 var (
-	apiCallConfig    apiCallStruct
-	boolConfLoaded   bool
-	configDebug      bool
-	configFileName   string
-	configVersion    bool
-	configTimeout    int
-	configSkipInsert bool
-	connString       string
-	davEndpoint      string
-	espXmlmc         *apiLib.XmlmcInstStruct
-	logFile          string
-	db               *sqlx.DB
+	apiCallConfig     apiCallStruct
+	boolConfLoaded    bool
+	configDebug       bool
+	configFileName    string
+	configVersion     bool
+	configTimeout     int
+	configConcurrency int
+	configSkipInsert  bool
+	configImport      string
+	configStateFile   string
+	configParams      = make(parameterFlags)
+	configReport      string
+	connString        string
+	davEndpoint       string
+	logFile           string
+	stdoutFile        *os.File
+	db                *sqlx.DB
 )
 
 type counterStruct struct {
 	success      int
 	failed       int
 	rowsaffected int
+	malformed    int
+	rejected     int
+	batches      map[string]*batchCounterStruct
+}
+
+// batchCounterStruct - Statistics for a destination that records are delivered to in batches
+type batchCounterStruct struct {
+	success       int
+	failed        int
+	records       int
+	failedRecords int
 }
 
 type apiCallStruct struct {
-	APIKey     string
-	InstanceID string
-	Database   struct {
+	APIKey           string
+	InstanceID       string
+	Concurrency      int
+	StateFile        string
+	StateMaxAge      int
+	StateMaxAttempts int
+	Database         struct {
 		Driver         string
 		Server         string
 		Database       string
@@ -53,13 +88,94 @@ type reportStruct struct {
 	DeleteReportInstance  bool
 	DeleteReportLocalFile bool
 	UseXLSX               bool
+	Sheet                 string
+	SheetIndex            *int
+	AllSheets             bool
+	SheetTables           map[string]dbConfigStruct
+	Files                 []reportFileMapStruct
+	CSV                   csvConfigStruct
+	MaxFailedRows         *int
+	MaxFailedPercent      *float64
+	AbortOnFailure        bool
+	StrictMapping         bool
+	PollInterval          int
+	PollBackoff           float64
+	MaxPollInterval       int
+	RunTimeout            int
+	CancelOnTimeout       bool
+	ReuseLatestRun        bool
+	MaxRunAge             int
+	Parameters            map[string]string
+	ParameterDateFormat   string
+	Destinations          []destinationStruct
 	Table                 dbConfigStruct
 }
 
+type reportFileMapStruct struct {
+	Pattern string
+	Table   dbConfigStruct
+}
+
+type destinationStruct struct {
+	Type              string
+	Path              string
+	Types             map[string]string
+	Endpoint          string
+	Region            string
+	Bucket            string
+	AccessKey         string
+	SecretKey         string
+	UsePathStyle      bool
+	UploadTransformed bool
+	URL               string
+	Index             string
+	SheetName         string
+	Headers           map[string]string
+	UserName          string
+	Password          string
+	Token             string
+	BatchSize         int
+	MaxRetries        *int
+	RetryDelay        int
+}
+
+// csvConfigStruct - Settings for reading CSV report files
+type csvConfigStruct struct {
+	Encoding          string
+	Delimiter         string
+	StrictQuotes      bool
+	Comment           string
+	SkipLines         int
+	SkipTrailingLines int
+}
+
+// outputContext - Identifies the report run file that records are being delivered for
+type outputContext struct {
+	Report   reportStruct
+	RunID    int
+	FileName string
+	RunDate  time.Time
+	Sheet    string
+	Header   []string
+	State    *reportStateStruct
+}
+
 type dbConfigStruct struct {
 	TableName  string
 	PrimaryKey string
 	Mapping    map[string]string
+	Validation map[string]validationRuleStruct
+}
+
+// validationRuleStruct - Rules a report column value must pass for the record to be delivered
+type validationRuleStruct struct {
+	Required      bool
+	Regex         string
+	MaxLength     int
+	AllowedValues []string
+	Min           *float64
+	Max           *float64
+	DateFormat    string
 }
 
 type stateStruct struct {
@@ -79,17 +195,24 @@ type xmlmcReportStatusResponse struct {
 	Params       paramsReportStruct `xml:"params"`
 }
 
+type xmlmcReportRunListResponse struct {
+	MethodResult string            `xml:"status,attr"`
+	State        stateStruct       `xml:"state"`
+	ReportRuns   []reportRunStruct `xml:"params>reportRun"`
+}
+
 type paramsReportStruct struct {
 	ReportRun reportRunStruct    `xml:"reportRun"`
 	Files     []reportFileStruct `xml:"files"`
 }
 
 type reportRunStruct struct {
-	RunID    int    `xml:"runId"`
-	ReportID int    `xml:"reportId"`
-	Status   string `xml:"status"`
-	RunBy    string `xml:"runBy"`
-	CSVLink  string `xml:"csvLink"`
+	RunID       int    `xml:"runId"`
+	ReportID    int    `xml:"reportId"`
+	Status      string `xml:"status"`
+	RunBy       string `xml:"runBy"`
+	CSVLink     string `xml:"csvLink"`
+	CompletedOn string `xml:"completedOn"`
 }
 
 type reportFileStruct struct {
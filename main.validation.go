@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// recordValidator - Checks report records against the validation rules of the table definition
+type recordValidator struct {
+	columns []string
+	rules   map[string]validationRuleStruct
+	regexes map[string]*regexp.Regexp
+}
+
+// newRecordValidator -- Compiles the validation rules of the table, returning an error if a rule is invalid
+func newRecordValidator(table dbConfigStruct) (*recordValidator, error) {
+	v := &recordValidator{
+		rules:   table.Validation,
+		regexes: make(map[string]*regexp.Regexp),
+	}
+	for column, rule := range table.Validation {
+		v.columns = append(v.columns, column)
+		if rule.Regex != "" {
+			regex, err := regexp.Compile(rule.Regex)
+			if err != nil {
+				return nil, errors.New("invalid Regex for column " + column + ": " + err.Error())
+			}
+			v.regexes[column] = regex
+		}
+	}
+	//-- Check the columns in a fixed order so the same failed rule is reported for a record each run
+	sort.Strings(v.columns)
+	return v, nil
+}
+
+// validate - returns an empty string if the record passes every rule, otherwise a description of the first rule failed.
+// -- Rules other than Required are only checked when the column has a value
+func (v *recordValidator) validate(reportRow map[string]string) string {
+	for _, column := range v.columns {
+		rule := v.rules[column]
+		value, found := reportRow[column]
+		if strings.TrimSpace(value) == "" {
+			if rule.Required {
+				if !found {
+					return "[" + column + "] Required: column not found in report"
+				}
+				return "[" + column + "] Required: value is empty"
+			}
+			continue
+		}
+		if regex, ok := v.regexes[column]; ok && !regex.MatchString(value) {
+			return "[" + column + "] Regex: value does not match " + rule.Regex
+		}
+		if rule.MaxLength > 0 && utf8.RuneCountInString(value) > rule.MaxLength {
+			return "[" + column + "] MaxLength: value is longer than " + strconv.Itoa(rule.MaxLength) + " characters"
+		}
+		if len(rule.AllowedValues) > 0 && !stringInSlice(value, rule.AllowedValues) {
+			return "[" + column + "] AllowedValues: value is not one of " + strings.Join(rule.AllowedValues, ", ")
+		}
+		if rule.Min != nil || rule.Max != nil {
+			number, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if err != nil {
+				return "[" + column + "] Min/Max: value is not a number"
+			}
+			if rule.Min != nil && number < *rule.Min {
+				return "[" + column + "] Min: value is less than " + strconv.FormatFloat(*rule.Min, 'f', -1, 64)
+			}
+			if rule.Max != nil && number > *rule.Max {
+				return "[" + column + "] Max: value is greater than " + strconv.FormatFloat(*rule.Max, 'f', -1, 64)
+			}
+		}
+		if rule.DateFormat != "" {
+			if _, err := time.Parse(rule.DateFormat, value); err != nil {
+				return "[" + column + "] DateFormat: value is not a date in the format " + rule.DateFormat
+			}
+		}
+	}
+	return ""
+}
+
+// logRejectedRecord -- Logs the validation rule a record failed, along with the record itself
+func logRejectedRecord(failedRule string, reportRow map[string]string) {
+	logger(5, "Record rejected by validation rule "+failedRule, false)
+	jsonRecord, _ := json.Marshal(reportRow)
+	logger(3, "[RECORD] "+string(jsonRecord), false)
+}
+
+func stringInSlice(value string, list []string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,60 @@
+package main
+
+import "testing"
+
+func TestRecordValidator(t *testing.T) {
+	min, max := 1.0, 5.0
+	table := dbConfigStruct{Validation: map[string]validationRuleStruct{
+		"id":       {Required: true, Regex: `^[A-Z]{2}\d+$`},
+		"summary":  {MaxLength: 10},
+		"status":   {AllowedValues: []string{"open", "closed"}},
+		"priority": {Min: &min, Max: &max},
+		"logged":   {DateFormat: "2006-01-02 15:04:05"},
+		"missing":  {Required: true},
+	}}
+	validRow := func() map[string]string {
+		return map[string]string{"id": "IN123", "summary": "Printer", "status": "open", "priority": "3", "logged": "2024-01-31 09:30:00", "missing": "x"}
+	}
+	tests := []struct {
+		name   string
+		column string
+		value  string
+		remove bool
+		want   string
+	}{
+		{"valid", "", "", false, ""},
+		{"required empty", "id", " ", false, "[id] Required: value is empty"},
+		{"required not found", "missing", "", true, "[missing] Required: column not found in report"},
+		{"regex", "id", "in123", false, "[id] Regex: value does not match ^[A-Z]{2}\\d+$"},
+		{"max length", "summary", "Printer jammed", false, "[summary] MaxLength: value is longer than 10 characters"},
+		{"max length counts characters", "summary", "ééééééééé", false, ""},
+		{"allowed values", "status", "pending", false, "[status] AllowedValues: value is not one of open, closed"},
+		{"not a number", "priority", "high", false, "[priority] Min/Max: value is not a number"},
+		{"below min", "priority", "0", false, "[priority] Min: value is less than 1"},
+		{"above max", "priority", "5.5", false, "[priority] Max: value is greater than 5"},
+		{"date format", "logged", "31/01/2024", false, "[logged] DateFormat: value is not a date in the format 2006-01-02 15:04:05"},
+		{"optional empty", "priority", "", false, ""},
+	}
+	validator, err := newRecordValidator(table)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		row := validRow()
+		if tt.remove {
+			delete(row, tt.column)
+		} else if tt.column != "" {
+			row[tt.column] = tt.value
+		}
+		if got := validator.validate(row); got != tt.want {
+			t.Errorf("%s: validate = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRecordValidatorInvalidRegex(t *testing.T) {
+	table := dbConfigStruct{Validation: map[string]validationRuleStruct{"id": {Regex: "["}}}
+	if _, err := newRecordValidator(table); err == nil {
+		t.Error("newRecordValidator with an invalid Regex did not return an error")
+	}
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/xuri/excelize/v2"
+)
+
+const (
+	workbookDefaultPath = "reports/DataExport_{Date}.xlsx"
+	workbookMaxColWidth = 60
+	workbookMinColWidth = 8
+	//-- Sheet names are limited to 31 characters by Excel
+	workbookMaxSheetName = 31
+	//-- The sheet created with each workbook, removed when saved unless a report uses it
+	workbookDefaultSheet = "Sheet1"
+)
+
+// workbooks - Workbooks being collected from the report destinations, keyed on the output path.
+// -- Workbooks are held in memory until saveWorkbooks is called once all reports have run
+var (
+	workbooks     = make(map[string]*workbookStruct)
+	workbooksLock sync.Mutex
+)
+
+// workbookStruct - A workbook being collected, with one sheet per report. sheetNames holds the
+// -- sheet given to each report and requested sheet name, as sheet names must be unique
+type workbookStruct struct {
+	file        *excelize.File
+	headerStyle int
+	sheets      map[string]*workbookSheetStruct
+	sheetNames  map[string]string
+	sheetOrder  []string
+}
+
+// workbookSheetStruct - The columns and next free row of a report sheet
+type workbookSheetStruct struct {
+	header    []string
+	nextRow   int
+	colWidths []int
+}
+
+// workbookSink - Adds the parsed report records to a named sheet of a shared XLSX workbook
+type workbookSink struct {
+	destination destinationStruct
+	workbook    *workbookStruct
+	sheet       *workbookSheetStruct
+	sheetName   string
+}
+
+func newWorkbookSink(destination destinationStruct) sink {
+	return &workbookSink{destination: destination}
+}
+
+// Open - finds or creates the workbook and the sheet for the report
+func (s *workbookSink) Open(output outputContext) error {
+	if len(output.Header) == 0 {
+		return errors.New("no columns found in report file")
+	}
+	outputPath := s.destination.Path
+	if outputPath == "" {
+		outputPath = workbookDefaultPath
+	}
+	outputPath = expandPathTemplate(outputPath, output)
+	sheetName := s.destination.SheetName
+	if sheetName == "" {
+		sheetName = output.Report.ReportName
+	}
+	requestedName := expandPathTemplate(sheetName, output)
+	sheetKey := strconv.Itoa(output.Report.ReportID) + "|" + output.Report.ReportName + "|" + requestedName
+
+	workbooksLock.Lock()
+	defer workbooksLock.Unlock()
+	workbook, ok := workbooks[outputPath]
+	if !ok {
+		file := excelize.NewFile()
+		headerStyle, err := file.NewStyle(&excelize.Style{
+			Font:      &excelize.Font{Bold: true, Color: "FFFFFF"},
+			Fill:      excelize.Fill{Type: "pattern", Pattern: 1, Color: []string{"4F81BD"}},
+			Alignment: &excelize.Alignment{Vertical: "center"},
+		})
+		if err != nil {
+			return err
+		}
+		workbook = &workbookStruct{
+			file:        file,
+			headerStyle: headerStyle,
+			sheets:      make(map[string]*workbookSheetStruct),
+			sheetNames:  make(map[string]string),
+		}
+		workbooks[outputPath] = workbook
+	}
+
+	//-- Further files from the same report run are appended to the report sheet, other reports are
+	//-- given their own sheet even when their names match once made valid
+	sheetName, ok = workbook.sheetNames[sheetKey]
+	sheet := workbook.sheets[sheetName]
+	if !ok {
+		sheetName = workbook.uniqueSheetName(workbookSheetName(requestedName))
+		if _, err := workbook.file.NewSheet(sheetName); err != nil {
+			return err
+		}
+		sheet = &workbookSheetStruct{header: output.Header, nextRow: 1, colWidths: make([]int, len(output.Header))}
+		headerRow := make([]interface{}, len(output.Header))
+		for i, column := range output.Header {
+			headerRow[i] = column
+			sheet.colWidths[i] = utf8.RuneCountInString(column)
+		}
+		if err := workbook.file.SetSheetRow(sheetName, "A1", &headerRow); err != nil {
+			return err
+		}
+		sheet.nextRow = 2
+		workbook.sheets[sheetName] = sheet
+		workbook.sheetNames[sheetKey] = sheetName
+		workbook.sheetOrder = append(workbook.sheetOrder, sheetName)
+	}
+	s.workbook = workbook
+	s.sheet = sheet
+	s.sheetName = sheetName
+	logger(3, "Adding records to sheet "+sheetName+" of workbook "+outputPath, true)
+	return nil
+}
+
+// WriteBatch - writes the records to the sheet in the column order of the report header
+func (s *workbookSink) WriteBatch(rows []map[string]string, counters *counterStruct) error {
+	workbooksLock.Lock()
+	defer workbooksLock.Unlock()
+	for _, reportRow := range rows {
+		sheetRow := make([]interface{}, len(s.sheet.header))
+		for i, column := range s.sheet.header {
+			sheetRow[i] = reportRow[column]
+			if width := utf8.RuneCountInString(reportRow[column]); width > s.sheet.colWidths[i] {
+				s.sheet.colWidths[i] = width
+			}
+		}
+		cell, err := excelize.CoordinatesToCellName(1, s.sheet.nextRow)
+		if err != nil {
+			return err
+		}
+		if err := s.workbook.file.SetSheetRow(s.sheetName, cell, &sheetRow); err != nil {
+			return err
+		}
+		s.sheet.nextRow++
+	}
+	return nil
+}
+
+// Commit - the workbook is saved by saveWorkbooks once all reports have run
+func (s *workbookSink) Commit(counters *counterStruct) error {
+	return nil
+}
+
+// Close - the workbook is shared with other reports, so is left open
+func (s *workbookSink) Close() error {
+	return nil
+}
+
+// saveWorkbooks -- Formats each sheet of the collected workbooks, then saves them
+// -- Returns false if any workbook could not be saved
+func saveWorkbooks() bool {
+	workbooksLock.Lock()
+	defer workbooksLock.Unlock()
+	outputPaths := []string{}
+	for outputPath := range workbooks {
+		outputPaths = append(outputPaths, outputPath)
+	}
+	sort.Strings(outputPaths)
+
+	success := true
+	for _, outputPath := range outputPaths {
+		workbook := workbooks[outputPath]
+		if err := workbook.save(outputPath); err != nil {
+			logger(4, "Error saving workbook "+outputPath+": "+fmt.Sprintf("%v", err), true)
+			success = false
+		} else {
+			logger(3, "Saved workbook "+outputPath+" with "+strconv.Itoa(len(workbook.sheetOrder))+" sheets", true)
+		}
+		workbook.file.Close()
+		delete(workbooks, outputPath)
+	}
+	return success
+}
+
+// save - styles the header row, freezes it and adds an autofilter and column widths to each sheet
+func (w *workbookStruct) save(outputPath string) error {
+	for _, sheetName := range w.sheetOrder {
+		sheet := w.sheets[sheetName]
+		lastCol, err := excelize.ColumnNumberToName(len(sheet.header))
+		if err != nil {
+			return err
+		}
+		if err := w.file.SetCellStyle(sheetName, "A1", lastCol+"1", w.headerStyle); err != nil {
+			return err
+		}
+		if err := w.file.SetPanes(sheetName, &excelize.Panes{
+			Freeze:      true,
+			YSplit:      1,
+			TopLeftCell: "A2",
+			ActivePane:  "bottomLeft",
+		}); err != nil {
+			return err
+		}
+		if err := w.file.AutoFilter(sheetName, "A1:"+lastCol+strconv.Itoa(sheet.nextRow-1), nil); err != nil {
+			return err
+		}
+		for i, width := range sheet.colWidths {
+			colName, _ := excelize.ColumnNumberToName(i + 1)
+			colWidth := float64(width + 2)
+			if colWidth > workbookMaxColWidth {
+				colWidth = workbookMaxColWidth
+			} else if colWidth < workbookMinColWidth {
+				colWidth = workbookMinColWidth
+			}
+			if err := w.file.SetColWidth(sheetName, colName, colName, colWidth); err != nil {
+				return err
+			}
+		}
+	}
+
+	//-- Remove the default sheet created with the workbook, unless a report is using it
+	if _, ok := w.sheets[workbookDefaultSheet]; !ok && len(w.sheetOrder) > 0 {
+		if err := w.file.DeleteSheet(workbookDefaultSheet); err != nil {
+			return err
+		}
+		if index, err := w.file.GetSheetIndex(w.sheetOrder[0]); err == nil {
+			w.file.SetActiveSheet(index)
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(outputPath), 0777); err != nil {
+		return err
+	}
+	return w.file.SaveAs(outputPath)
+}
+
+// workbookSheetName -- Converts a report name to a valid sheet name
+func workbookSheetName(name string) string {
+	replacer := strings.NewReplacer("[", "(", "]", ")", ":", "-", "*", "-", "?", "", "/", "-", "\\", "-")
+	name = strings.Trim(replacer.Replace(name), "'")
+	if name == "" {
+		name = "Report"
+	}
+	if utf8.RuneCountInString(name) > workbookMaxSheetName {
+		name = string([]rune(name)[:workbookMaxSheetName])
+	}
+	return name
+}
+
+// uniqueSheetName - returns the sheet name, with a _2, _3... suffix when the workbook already has a sheet of
+// -- that name. Sheet names are compared ignoring case, as they are by Excel. A name matching the default
+// -- sheet takes it over, so it is not removed when the workbook is saved
+func (w *workbookStruct) uniqueSheetName(name string) string {
+	if strings.EqualFold(name, workbookDefaultSheet) {
+		name = workbookDefaultSheet
+	}
+	uniqueName := name
+	for suffix := 2; w.hasSheet(uniqueName); suffix++ {
+		suffixText := "_" + strconv.Itoa(suffix)
+		baseName := []rune(name)
+		if len(baseName)+len(suffixText) > workbookMaxSheetName {
+			baseName = baseName[:workbookMaxSheetName-len(suffixText)]
+		}
+		uniqueName = string(baseName) + suffixText
+	}
+	return uniqueName
+}
+
+// hasSheet - returns true if a report is already using a sheet of the name, ignoring case
+func (w *workbookStruct) hasSheet(name string) bool {
+	for sheetName := range w.sheets {
+		if strings.EqualFold(sheetName, name) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+)
+
+func TestWorkbookSheetNames(t *testing.T) {
+	workbookPath := filepath.Join(t.TempDir(), "export.xlsx")
+	destination := destinationStruct{Type: "workbook", Path: workbookPath}
+	files := []struct {
+		report reportStruct
+		id     string
+	}{
+		{reportStruct{ReportID: 1, ReportName: "Incident Management Daily Summary - Team A"}, "a1"},
+		{reportStruct{ReportID: 2, ReportName: "Incident Management Daily Summary - Team B"}, "b1"},
+		{reportStruct{ReportID: 3, ReportName: "Changes"}, "c1"},
+		{reportStruct{ReportID: 4, ReportName: "CHANGES"}, "d1"},
+		{reportStruct{ReportID: 5, ReportName: "sheet1"}, "e1"},
+		//-- A further file from the first report is added to its sheet
+		{reportStruct{ReportID: 1, ReportName: "Incident Management Daily Summary - Team A"}, "a2"},
+	}
+	for _, file := range files {
+		s := newWorkbookSink(destination)
+		output := outputContext{Report: file.report, FileName: file.id + ".csv", Header: []string{"id"}}
+		if err := s.Open(output); err != nil {
+			t.Fatalf("Open %s: %v", file.report.ReportName, err)
+		}
+		if err := s.WriteBatch([]map[string]string{{"id": file.id}}, &counterStruct{}); err != nil {
+			t.Fatalf("WriteBatch %s: %v", file.report.ReportName, err)
+		}
+	}
+	if !saveWorkbooks() {
+		t.Fatal("saveWorkbooks failed")
+	}
+
+	xlsx, err := excelize.OpenFile(workbookPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer xlsx.Close()
+	wantSheets := map[string][][]string{
+		"Incident Management Daily Summa": {{"id"}, {"a1"}, {"a2"}},
+		"Incident Management Daily Sum_2": {{"id"}, {"b1"}},
+		"Changes":                         {{"id"}, {"c1"}},
+		"CHANGES_2":                       {{"id"}, {"d1"}},
+		"Sheet1":                          {{"id"}, {"e1"}},
+	}
+	if got := xlsx.GetSheetList(); len(got) != len(wantSheets) {
+		t.Errorf("sheets = %q, want %d sheets", got, len(wantSheets))
+	}
+	for sheetName, wantRows := range wantSheets {
+		rows, err := xlsx.GetRows(sheetName)
+		if err != nil {
+			t.Errorf("GetRows(%q): %v", sheetName, err)
+			continue
+		}
+		if !reflect.DeepEqual(rows, wantRows) {
+			t.Errorf("sheet %q rows = %q, want %q", sheetName, rows, wantRows)
+		}
+	}
+}
+
+func TestWorkbookSheetName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"Incidents", "Incidents"},
+		{"Incidents [Daily]: 1/2", "Incidents (Daily)- 1-2"},
+		{"'Quoted'", "Quoted"},
+		{"?", "Report"},
+		{"A Report Name Longer Than Thirty One Characters", "A Report Name Longer Than Thirt"},
+	}
+	for _, tt := range tests {
+		if got := workbookSheetName(tt.name); got != tt.want {
+			t.Errorf("workbookSheetName(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
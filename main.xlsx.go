@@ -0,0 +1,143 @@
+package main
+
+import (
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// xlsxRecordReader - Streams records from an XLSX report file using the excelize rows iterator
+type xlsxRecordReader struct {
+	file      *excelize.File
+	rows      *excelize.Rows
+	header    []string
+	total     int
+	rowNumber int
+	malformed int
+}
+
+// xlsxSheets -- Returns the names of the sheets to read records from, as selected by the report
+// -- AllSheets, Sheet or SheetIndex settings. The first sheet in the workbook is read by default
+func xlsxSheets(xlsxFile string, report reportStruct) ([]string, bool) {
+	f, err := excelize.OpenFile(xlsxFile)
+	if err != nil {
+		logger(4, "Error opening XLSX file: "+err.Error(), true)
+		return nil, false
+	}
+	defer f.Close()
+	sheetList := f.GetSheetList()
+	if len(sheetList) == 0 {
+		logger(4, "No sheets found in XLSX file", true)
+		return nil, false
+	}
+
+	switch {
+	case report.AllSheets:
+		return sheetList, true
+	case report.Sheet != "":
+		for _, sheet := range sheetList {
+			if strings.EqualFold(sheet, report.Sheet) {
+				return []string{sheet}, true
+			}
+		}
+		logger(4, "Sheet "+report.Sheet+" not found in XLSX file, available sheets: "+strings.Join(sheetList, ", "), true)
+		return nil, false
+	case report.SheetIndex != nil:
+		if *report.SheetIndex < 1 || *report.SheetIndex > len(sheetList) {
+			logger(4, "SheetIndex "+strconv.Itoa(*report.SheetIndex)+" not found in XLSX file, which has "+strconv.Itoa(len(sheetList))+" sheets", true)
+			return nil, false
+		}
+		return []string{sheetList[*report.SheetIndex-1]}, true
+	}
+	return sheetList[:1], true
+}
+
+// newXLSXRecordReader -- Opens the XLSX file and counts the rows in the sheet, then positions the reader at the first record
+func newXLSXRecordReader(xlsxFile, sheet string) (recordReader, bool) {
+	f, err := excelize.OpenFile(xlsxFile)
+	if err != nil {
+		logger(4, "Error opening XLSX file: "+err.Error(), true)
+		return nil, false
+	}
+	r := &xlsxRecordReader{file: f}
+
+	//-- Count the rows first, so the progress and failure thresholds can be measured against the total
+	rows, err := f.Rows(sheet)
+	if err != nil {
+		logger(4, "Error reading XLSX file: "+err.Error(), true)
+		f.Close()
+		return nil, false
+	}
+	for rows.Next() {
+		r.total++
+	}
+	err = rows.Error()
+	rows.Close()
+	if err != nil {
+		logger(4, "Error reading XLSX file: "+err.Error(), true)
+		f.Close()
+		return nil, false
+	}
+	if r.total > 0 {
+		//-- First row read is the header
+		r.total--
+	}
+
+	r.rows, err = f.Rows(sheet)
+	if err == nil && r.rows.Next() {
+		r.rowNumber++
+		r.header, err = r.rows.Columns()
+		r.header = uniqueHeader(r.header)
+	}
+	if err != nil {
+		logger(4, "Error reading XLSX file: "+err.Error(), true)
+		r.Close()
+		return nil, false
+	}
+	return r, true
+}
+
+// Header - returns the column names from the first row of the sheet
+func (r *xlsxRecordReader) Header() []string {
+	return r.header
+}
+
+// Total - returns the number of records in the sheet, excluding the header
+func (r *xlsxRecordReader) Total() int {
+	return r.total
+}
+
+// Read - returns the next record keyed on the header column names, or io.EOF once all rows are read
+func (r *xlsxRecordReader) Read() (map[string]string, error) {
+	if !r.rows.Next() {
+		if err := r.rows.Error(); err != nil {
+			return nil, err
+		}
+		return nil, io.EOF
+	}
+	r.rowNumber++
+	row, err := r.rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	dict, malformed := buildRecord(r.header, row, "row "+strconv.Itoa(r.rowNumber), false)
+	if malformed {
+		r.malformed++
+	}
+	return dict, nil
+}
+
+// Malformed - returns the number of rows read with values beyond the header columns
+func (r *xlsxRecordReader) Malformed() int {
+	return r.malformed
+}
+
+// Close - closes the rows iterator and the workbook, removing any temporary files created while reading
+func (r *xlsxRecordReader) Close() error {
+	if r.rows != nil {
+		r.rows.Close()
+	}
+	return r.file.Close()
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestMain -- Runs the tests from a temporary folder, so the log files written by the tool are not left in the repository
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "dataexport")
+	if err != nil {
+		panic(err)
+	}
+	cwd, _ := os.Getwd()
+	os.Chdir(dir)
+	logFile = "test.log"
+	code := m.Run()
+	os.Chdir(cwd)
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// writeTestReport -- Writes a CSV report file holding records with the IDs 1 to records
+func writeTestReport(t *testing.T, records int) string {
+	t.Helper()
+	var content strings.Builder
+	content.WriteString("id\n")
+	for i := 1; i <= records; i++ {
+		content.WriteString(strconv.Itoa(i) + "\n")
+	}
+	reportFile := filepath.Join(t.TempDir(), "report.csv")
+	if err := os.WriteFile(reportFile, []byte(content.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return reportFile
+}
+
+// testEndpoint - A HTTP destination that records the IDs of the records it accepts, and rejects
+// -- any request holding a record for which fail returns true
+type testEndpoint struct {
+	server *httptest.Server
+	lock   sync.Mutex
+	ids    []string
+	fail   func(id string) bool
+}
+
+func newTestEndpoint(t *testing.T, fail func(id string) bool) *testEndpoint {
+	e := &testEndpoint{fail: fail}
+	e.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var records []map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&records); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		e.lock.Lock()
+		defer e.lock.Unlock()
+		for _, record := range records {
+			if e.fail != nil && e.fail(record["id"]) {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+		}
+		for _, record := range records {
+			e.ids = append(e.ids, record["id"])
+		}
+	}))
+	t.Cleanup(e.server.Close)
+	return e
+}
+
+// received - returns the IDs of the records accepted by the endpoint
+func (e *testEndpoint) received() []string {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	return append([]string{}, e.ids...)
+}
+
+// destination - returns a http destination for the endpoint, sending batches of batchSize records without retries
+func (e *testEndpoint) destination(batchSize int) destinationStruct {
+	maxRetries := 0
+	return destinationStruct{Type: "http", URL: e.server.URL, BatchSize: batchSize, MaxRetries: &maxRetries}
+}
+
+// readTestJSONLines -- Returns the IDs of the records in a JSON Lines file
+func readTestJSONLines(t *testing.T, jsonlFile string) []string {
+	t.Helper()
+	content, err := os.ReadFile(jsonlFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := []string{}
+	for _, line := range strings.Split(strings.TrimSpace(string(content)), "\n") {
+		var record map[string]string
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("invalid JSON line %q: %v", line, err)
+		}
+		ids = append(ids, record["id"])
+	}
+	return ids
+}
+
+// testIDs -- Returns the record IDs from first to last
+func testIDs(first, last int) []string {
+	ids := []string{}
+	for i := first; i <= last; i++ {
+		ids = append(ids, strconv.Itoa(i))
+	}
+	return ids
+}
+
+// testOutput -- Returns the output context for delivering the records of a test report file
+func testOutput(report reportStruct, state *reportStateStruct) outputContext {
+	report.Table = dbConfigStruct{Mapping: map[string]string{"id": "id"}}
+	return outputContext{Report: report, RunID: 1, FileName: "report.csv", RunDate: time.Now(), State: state}
+}
+
+func TestFailureThresholdExceeded(t *testing.T) {
+	intPtr := func(i int) *int { return &i }
+	floatPtr := func(f float64) *float64 { return &f }
+	tests := []struct {
+		name         string
+		report       reportStruct
+		counters     counterStruct
+		totalRecords int
+		want         bool
+	}{
+		{"no thresholds", reportStruct{}, counterStruct{failed: 100}, 100, false},
+		{"zero rows, none failed", reportStruct{MaxFailedRows: intPtr(0)}, counterStruct{success: 100}, 100, false},
+		{"zero rows, one failed", reportStruct{MaxFailedRows: intPtr(0)}, counterStruct{failed: 1}, 100, true},
+		{"rows at limit", reportStruct{MaxFailedRows: intPtr(2)}, counterStruct{failed: 2}, 100, false},
+		{"rows over limit", reportStruct{MaxFailedRows: intPtr(2)}, counterStruct{failed: 3}, 100, true},
+		{"rejected records don't count", reportStruct{MaxFailedRows: intPtr(0)}, counterStruct{rejected: 5, malformed: 5}, 100, false},
+		{"zero percent, none failed", reportStruct{MaxFailedPercent: floatPtr(0)}, counterStruct{}, 100, false},
+		{"zero percent, one failed", reportStruct{MaxFailedPercent: floatPtr(0)}, counterStruct{failed: 1}, 100, true},
+		{"percent at limit", reportStruct{MaxFailedPercent: floatPtr(10)}, counterStruct{failed: 10}, 100, false},
+		{"percent over limit", reportStruct{MaxFailedPercent: floatPtr(10)}, counterStruct{failed: 11}, 100, true},
+		{"fractional percent", reportStruct{MaxFailedPercent: floatPtr(0.5)}, counterStruct{failed: 1}, 300, false},
+		{"percent with no records", reportStruct{MaxFailedPercent: floatPtr(0)}, counterStruct{}, 0, false},
+		{"rows within, percent over", reportStruct{MaxFailedRows: intPtr(50), MaxFailedPercent: floatPtr(10)}, counterStruct{failed: 20}, 100, true},
+		{"percent within, rows over", reportStruct{MaxFailedRows: intPtr(5), MaxFailedPercent: floatPtr(10)}, counterStruct{failed: 6}, 100, true},
+		{"failed batch records", reportStruct{MaxFailedRows: intPtr(2)}, counterStruct{batches: map[string]*batchCounterStruct{
+			"HTTP": {failed: 1, failedRecords: 3},
+		}}, 100, true},
+		{"failed queries and batch records", reportStruct{MaxFailedRows: intPtr(4)}, counterStruct{failed: 2, batches: map[string]*batchCounterStruct{
+			"HTTP":  {failed: 1, failedRecords: 2},
+			"Index": {failed: 1, failedRecords: 1},
+		}}, 100, true},
+		{"successful batches", reportStruct{MaxFailedRows: intPtr(0)}, counterStruct{batches: map[string]*batchCounterStruct{
+			"HTTP": {success: 5, records: 500},
+		}}, 500, false},
+	}
+	for _, tt := range tests {
+		if got := failureThresholdExceeded(tt.report, tt.counters, tt.totalRecords); got != tt.want {
+			t.Errorf("%s: failureThresholdExceeded = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRunExitCode(t *testing.T) {
+	tests := []struct {
+		failedReports  int
+		totalReports   int
+		workbooksSaved bool
+		want           int
+	}{
+		{0, 3, true, 0},
+		{1, 3, true, exitCodePartialFailure},
+		{3, 3, true, exitCodeTotalFailure},
+		{0, 3, false, exitCodePartialFailure},
+		{3, 3, false, exitCodeTotalFailure},
+		{0, 0, true, 0},
+	}
+	for _, tt := range tests {
+		if got := runExitCode(tt.failedReports, tt.totalReports, tt.workbooksSaved); got != tt.want {
+			t.Errorf("runExitCode(%d, %d, %v) = %d, want %d", tt.failedReports, tt.totalReports, tt.workbooksSaved, got, tt.want)
+		}
+	}
+}
+
+func TestDeliverRecordsAbortOnFailure(t *testing.T) {
+	maxFailedRows := 1
+	tests := []struct {
+		name           string
+		abortOnFailure bool
+		wantDelivered  []string
+		wantWritten    []string
+	}{
+		//-- The second failed record, 5, exceeds MaxFailedRows so no more records are read
+		{"abort on failure", true, []string{"1", "2", "4"}, testIDs(1, 5)},
+		{"continue on failure", false, []string{"1", "2", "4", "6", "7", "8", "9", "10"}, testIDs(1, 10)},
+	}
+	for _, tt := range tests {
+		endpoint := newTestEndpoint(t, func(id string) bool { return id == "3" || id == "5" })
+		jsonlFile := filepath.Join(t.TempDir(), "report.jsonl")
+		destinations := []destinationStruct{endpoint.destination(1), {Type: "jsonl", Path: jsonlFile}}
+		report := reportStruct{ReportName: "Abort", MaxFailedRows: &maxFailedRows, AbortOnFailure: tt.abortOnFailure}
+
+		success, _ := deliverRecords(writeTestReport(t, 10), testOutput(report, nil), destinations)
+		if success {
+			t.Errorf("%s: deliverRecords succeeded with the failure threshold exceeded", tt.name)
+		}
+		if got := endpoint.received(); strings.Join(got, ",") != strings.Join(tt.wantDelivered, ",") {
+			t.Errorf("%s: records delivered = %q, want %q", tt.name, got, tt.wantDelivered)
+		}
+		if got := readTestJSONLines(t, jsonlFile); strings.Join(got, ",") != strings.Join(tt.wantWritten, ",") {
+			t.Errorf("%s: records written = %q, want %q", tt.name, got, tt.wantWritten)
+		}
+	}
+}
+
+func TestDeliverRecordsWithinThreshold(t *testing.T) {
+	maxFailedRows := 1
+	endpoint := newTestEndpoint(t, func(id string) bool { return id == "3" })
+	report := reportStruct{ReportName: "Threshold", MaxFailedRows: &maxFailedRows, AbortOnFailure: true}
+	success, _ := deliverRecords(writeTestReport(t, 5), testOutput(report, nil), []destinationStruct{endpoint.destination(1)})
+	if !success {
+		t.Error("deliverRecords failed with the failed records within the threshold")
+	}
+	if got, want := endpoint.received(), []string{"1", "2", "4", "5"}; strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("records delivered = %q, want %q", got, want)
+	}
+}
+
+func TestDeliverRecordsRowsLoaded(t *testing.T) {
+	maxFailedRows := 0
+	tests := []struct {
+		name           string
+		batchSize      int
+		failID         string
+		wantRowsLoaded int
+	}{
+		{"all delivered", 50, "", 250},
+		//-- Records 151 to 200 fail in the second batch of the tool, so only the first is saved
+		{"failed batch", 50, "160", 100},
+		//-- Records 81 to 100 are still buffered by the http destination after the first batch of the
+		//-- tool, and the batch holding 190 fails before the second is delivered, so nothing is saved
+		{"pending records", 40, "190", 0},
+	}
+	for _, tt := range tests {
+		useTestStateFile(t)
+		endpoint := newTestEndpoint(t, func(id string) bool { return id == tt.failID })
+		jsonlFile := filepath.Join(t.TempDir(), "report.jsonl")
+		destinations := []destinationStruct{endpoint.destination(tt.batchSize), {Type: "jsonl", Path: jsonlFile}}
+		report := reportStruct{ReportID: 1, ReportName: "Rows Loaded", MaxFailedRows: &maxFailedRows}
+		state := reportState(report)
+		state.setRun(10, false)
+
+		success, _ := deliverRecords(writeTestReport(t, 250), testOutput(report, state), destinations)
+		if success != (tt.failID == "") {
+			t.Errorf("%s: deliverRecords = %v, want %v", tt.name, success, tt.failID == "")
+		}
+		if got := state.rowsLoaded("report.csv"); got != tt.wantRowsLoaded {
+			t.Errorf("%s: RowsLoaded = %d, want %d", tt.name, got, tt.wantRowsLoaded)
+		}
+		if got := readTestJSONLines(t, jsonlFile); len(got) != 250 {
+			t.Errorf("%s: %d records written to the jsonl destination, want 250", tt.name, len(got))
+		}
+	}
+}
+
+func TestDeliverRecordsResume(t *testing.T) {
+	useTestStateFile(t)
+	endpoint := newTestEndpoint(t, nil)
+	jsonlFile := filepath.Join(t.TempDir(), "report.jsonl")
+	destinations := []destinationStruct{endpoint.destination(50), {Type: "jsonl", Path: jsonlFile}}
+	report := reportStruct{ReportID: 1, ReportName: "Resume"}
+	state := reportState(report)
+	state.setRun(10, false)
+	//-- Resume part way through a batch of the tool, so the batch is split between the destinations
+	state.setRowsLoaded("report.csv", 130)
+
+	success, _ := deliverRecords(writeTestReport(t, 250), testOutput(report, state), destinations)
+	if !success {
+		t.Error("deliverRecords failed")
+	}
+	if got, want := endpoint.received(), testIDs(131, 250); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("records delivered to the http destination = %q, want 131 to 250", got)
+	}
+	if got, want := readTestJSONLines(t, jsonlFile), testIDs(1, 250); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("records written to the jsonl destination = %q, want 1 to 250", got)
+	}
+	if got := state.rowsLoaded("report.csv"); got != 250 {
+		t.Errorf("RowsLoaded = %d, want 250", got)
+	}
+}